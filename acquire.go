@@ -0,0 +1,161 @@
+/*
+Package database provides a bounded wait for pooled connections.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+database/sql blocks indefinitely waiting for a free connection when the pool is exhausted
+and the query context has no deadline. When Config.AcquireTimeout is set, every statement
+first acquires a connection with its own deadline and fails with ErrPoolExhausted when the
+wait exceeds it. The statement itself still runs under the caller's context, so pool-wait
+timeouts can be told apart from query timeouts.
+
+Example usage:
+
+	cfg.AcquireTimeout = 500 * time.Millisecond
+	db, _ := database.CreatePostgreSQL(cfg)
+
+	err := db.WithContext(ctx).Find(&users).Error
+	if errors.Is(err, database.ErrPoolExhausted) {
+	    // shed load, e.g. respond with 503
+	}
+
+Notes:
+  - Statements that run on an explicit transaction use the transaction's connection and are
+    not bounded; the connection they use is acquired by BEGIN.
+  - The bound is not applied while Config.PrepareStmt is enabled.
+*/
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrPoolExhausted is returned when no pooled connection became available within Config.AcquireTimeout.
+var ErrPoolExhausted = errors.New("timed out waiting for a pooled connection")
+
+// acquiredConnKey is the statement instance key holding the connection acquired for a statement.
+const acquiredConnKey = "database:acquired_conn"
+
+// acquiredConn records a connection acquired for a single statement and the pool it came from.
+type acquiredConn struct {
+	conn *sql.Conn
+	pool *sql.DB
+}
+
+// registerAcquireTimeout registers callbacks that acquire a connection within timeout before
+// each statement and return it to the pool afterwards.
+func registerAcquireTimeout(gormDB *gorm.DB, timeout time.Duration) error {
+	acquire := acquireConn(timeout)
+	cb := gormDB.Callback()
+
+	// Create, update and delete open their default transaction in gorm:begin_transaction,
+	// so the connection must be acquired before it and released after the commit.
+	if err := cb.Create().Before("gorm:begin_transaction").Register("database:acquire_conn", acquire); err != nil {
+		return err
+	}
+	if err := cb.Create().After("gorm:commit_or_rollback_transaction").Register("database:release_conn", releaseConn); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:begin_transaction").Register("database:acquire_conn", acquire); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:commit_or_rollback_transaction").Register("database:release_conn", releaseConn); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:begin_transaction").Register("database:acquire_conn", acquire); err != nil {
+		return err
+	}
+	if err := cb.Delete().After("gorm:commit_or_rollback_transaction").Register("database:release_conn", releaseConn); err != nil {
+		return err
+	}
+	if err := cb.Query().Before("gorm:query").Register("database:acquire_conn", acquire); err != nil {
+		return err
+	}
+	if err := cb.Query().After("gorm:query").Register("database:release_conn", releaseConn); err != nil {
+		return err
+	}
+	if err := cb.Raw().Before("gorm:raw").Register("database:acquire_conn", acquire); err != nil {
+		return err
+	}
+	if err := cb.Raw().After("gorm:raw").Register("database:release_conn", releaseConn); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:row").Register("database:acquire_conn", acquire); err != nil {
+		return err
+	}
+	// Rows returned by Row and Rows are still open when the callback chain ends; the
+	// connection is returned to the pool once the caller closes them.
+	return cb.Row().After("gorm:row").Register("database:release_conn", releaseConnAfterRows)
+}
+
+// acquireConn returns a callback that pins the statement to a connection acquired within timeout.
+func acquireConn(timeout time.Duration) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		// Dry runs, including subqueries being built, never reach the server.
+		if tx.Error != nil || tx.DryRun {
+			return
+		}
+
+		pool, ok := tx.Statement.ConnPool.(*sql.DB)
+		if !ok {
+			// Running inside a transaction or on a prepared statement pool.
+			return
+		}
+
+		ctx := tx.Statement.Context
+		acquireCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		conn, err := pool.Conn(acquireCtx)
+		if err != nil {
+			if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+				tx.AddError(fmt.Errorf("%w; waited %s", ErrPoolExhausted, timeout))
+				return
+			}
+			tx.AddError(fmt.Errorf("failed to acquire connection; %s", err.Error()))
+			return
+		}
+
+		tx.Statement.ConnPool = conn
+		tx.InstanceSet(acquiredConnKey, acquiredConn{conn: conn, pool: pool})
+	}
+}
+
+// releaseConn returns the connection acquired for the statement to the pool.
+func releaseConn(tx *gorm.DB) {
+	if acquired, ok := takeAcquiredConn(tx); ok {
+		acquired.conn.Close()
+	}
+}
+
+// releaseConnAfterRows returns the connection acquired for the statement to the pool once
+// any rows still reading from it are closed.
+func releaseConnAfterRows(tx *gorm.DB) {
+	if acquired, ok := takeAcquiredConn(tx); ok {
+		// Close blocks until open rows are closed by the caller.
+		go acquired.conn.Close()
+	}
+}
+
+// takeAcquiredConn restores the statement's original pool and returns the acquired connection, if any.
+func takeAcquiredConn(tx *gorm.DB) (acquiredConn, bool) {
+	v, _ := tx.InstanceGet(acquiredConnKey)
+	acquired, ok := v.(acquiredConn)
+	if !ok {
+		return acquiredConn{}, false
+	}
+
+	tx.InstanceSet(acquiredConnKey, nil)
+	tx.Statement.ConnPool = acquired.pool
+	return acquired, true
+}
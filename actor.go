@@ -0,0 +1,97 @@
+/*
+Package database provides automatic population of created_by and updated_by columns.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+When Config.TrackActor is enabled, creates set created_by and updated_by, and updates set
+updated_by, to the actor stored in the context with WithActor. Models without these columns
+are left untouched. Writes without an actor in the context are skipped, or rejected with
+ErrNoActor when Config.RequireActor is enabled.
+
+Example usage:
+
+	type Document struct {
+	    ID        uint
+	    Title     string
+	    CreatedBy string
+	    UpdatedBy string
+	}
+
+	ctx := database.WithActor(r.Context(), session.UserID)
+	db.WithContext(ctx).Create(&doc) // created_by and updated_by set to session.UserID
+*/
+
+package database
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// ErrNoActor is returned for writes without an actor in the context when Config.RequireActor is enabled.
+var ErrNoActor = errors.New("no actor in context")
+
+// Columns populated from the actor stored in the context.
+const (
+	createdByColumn = "created_by"
+	updatedByColumn = "updated_by"
+)
+
+// actorContextKey is the context key under which the actor is stored.
+type actorContextKey struct{}
+
+// WithActor returns a copy of ctx carrying actor, the identifier of the user or service
+// performing the writes. The actor must be assignable to the created_by and updated_by fields.
+func WithActor(ctx context.Context, actor interface{}) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actor)
+}
+
+// ActorFromContext returns the actor stored in ctx by WithActor, if any.
+func ActorFromContext(ctx context.Context) (interface{}, bool) {
+	actor := ctx.Value(actorContextKey{})
+	return actor, actor != nil
+}
+
+// registerActorTracking registers callbacks populating created_by and updated_by on create and update.
+func registerActorTracking(gormDB *gorm.DB, requireActor bool) error {
+	if err := gormDB.Callback().Create().Before("gorm:create").Register("database:track_actor", setActorColumns(requireActor, createdByColumn, updatedByColumn)); err != nil {
+		return err
+	}
+	return gormDB.Callback().Update().Before("gorm:update").Register("database:track_actor", setActorColumns(requireActor, updatedByColumn))
+}
+
+// setActorColumns returns a callback setting the given columns to the actor from the statement context.
+func setActorColumns(requireActor bool, columns ...string) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		if tx.Error != nil || tx.Statement.Schema == nil {
+			return
+		}
+
+		fields := make([]string, 0, len(columns))
+		for _, column := range columns {
+			if tx.Statement.Schema.LookUpField(column) != nil {
+				fields = append(fields, column)
+			}
+		}
+		if len(fields) == 0 {
+			return
+		}
+
+		actor, ok := ActorFromContext(tx.Statement.Context)
+		if !ok {
+			if requireActor {
+				tx.AddError(ErrNoActor)
+			}
+			return
+		}
+
+		for _, field := range fields {
+			tx.Statement.SetColumn(field, actor, true)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+/*
+Package database provides load shedding for statements under request storms.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+Under a thundering herd, a bounded pool still lets every goroutine queue for a connection,
+so latency grows without bound until requests time out. When Config.MaxConcurrentQueries is
+set, at most that many statements may run or wait for a connection at once; any statement
+beyond the limit fails immediately with ErrTooBusy, shedding load predictably.
+
+Example usage:
+
+	cfg.MaxConcurrentQueries = 200
+	db, _ := database.CreatePostgreSQL(cfg)
+
+	err := db.WithContext(ctx).Find(&users).Error
+	if errors.Is(err, database.ErrTooBusy) {
+	    // respond with 503 and a Retry-After header
+	}
+
+Notes:
+  - Statements inside a transaction already hold a connection and are always admitted, so a
+    transaction is never aborted midway; starting a transaction is not limited either.
+  - For Row and Rows, the statement leaves the limit once the query is sent, while its rows
+    are still being read.
+*/
+
+package database
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// ErrTooBusy is returned when a statement is rejected because Config.MaxConcurrentQueries statements are already running.
+var ErrTooBusy = errors.New("too many concurrent queries")
+
+// admittedKey is the statement instance key marking a statement admitted by the limit.
+const admittedKey = "database:admitted"
+
+// registerAdmission registers callbacks admitting at most limit statements at once.
+func registerAdmission(gormDB *gorm.DB, limit int) error {
+	slots := make(chan struct{}, limit)
+	admit := admitStatement(slots)
+	leave := leaveStatement(slots)
+	cb := gormDB.Callback()
+
+	// Create, update and delete acquire their connection in gorm:begin_transaction.
+	if err := cb.Create().Before("gorm:begin_transaction").Register("database:admit", admit); err != nil {
+		return err
+	}
+	if err := cb.Create().After("gorm:commit_or_rollback_transaction").Register("database:leave", leave); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:begin_transaction").Register("database:admit", admit); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:commit_or_rollback_transaction").Register("database:leave", leave); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:begin_transaction").Register("database:admit", admit); err != nil {
+		return err
+	}
+	if err := cb.Delete().After("gorm:commit_or_rollback_transaction").Register("database:leave", leave); err != nil {
+		return err
+	}
+	if err := cb.Query().Before("gorm:query").Register("database:admit", admit); err != nil {
+		return err
+	}
+	if err := cb.Query().After("gorm:query").Register("database:leave", leave); err != nil {
+		return err
+	}
+	if err := cb.Raw().Before("gorm:raw").Register("database:admit", admit); err != nil {
+		return err
+	}
+	if err := cb.Raw().After("gorm:raw").Register("database:leave", leave); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:row").Register("database:admit", admit); err != nil {
+		return err
+	}
+	return cb.Row().After("gorm:row").Register("database:leave", leave)
+}
+
+// admitStatement returns a callback taking one of slots for the statement, or failing it with
+// ErrTooBusy when none is free.
+func admitStatement(slots chan struct{}) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		if tx.Error != nil || tx.DryRun {
+			return
+		}
+		if _, ok := tx.Statement.ConnPool.(gorm.TxCommitter); ok {
+			// Running inside a transaction, on the connection it already holds.
+			return
+		}
+
+		select {
+		case slots <- struct{}{}:
+			tx.InstanceSet(admittedKey, true)
+		default:
+			tx.AddError(fmt.Errorf("%w; limit is %d", ErrTooBusy, cap(slots)))
+		}
+	}
+}
+
+// leaveStatement returns a callback freeing the slot taken by the statement, if any.
+func leaveStatement(slots chan struct{}) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		if admitted, _ := tx.InstanceGet(admittedKey); admitted != true {
+			return
+		}
+		tx.InstanceSet(admittedKey, false)
+		<-slots
+	}
+}
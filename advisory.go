@@ -0,0 +1,99 @@
+/*
+Package database provides a prepared statement advisory for repeated query shapes.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+Without Config.PrepareStmt, connections use the simple protocol and every statement is parsed
+and planned anew. When Config.PrepareAdvisoryThreshold is set, statements are grouped by their
+Fingerprint, and the first time a shape has run that many times a one-time advisory is logged
+at Warn level suggesting to enable prepared statements. Each shape is advised at most once.
+
+Example usage:
+
+	cfg.PrepareAdvisoryThreshold = 1000
+	db, _ := database.CreatePostgreSQL(cfg)
+	// [warn] query shape ran 1000 times without prepared statements; consider Config.PrepareStmt: SELECT * FROM "users" WHERE "users"."id" = ?
+
+Notes:
+  - At most 10000 distinct shapes are tracked, bounding memory for workloads
+    with generated SQL.
+*/
+
+package database
+
+import (
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// maxAdvisoryShapes is the number of distinct query shapes tracked by the advisory.
+const maxAdvisoryShapes = 10000
+
+// shapeCounter counts executions per query fingerprint.
+type shapeCounter struct {
+	mu        sync.Mutex
+	threshold int
+	counts    map[string]int // -1 once the shape has been advised
+}
+
+// count records one execution of fingerprint and reports whether it just reached the threshold.
+func (c *shapeCounter) count(fingerprint string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n, ok := c.counts[fingerprint]
+	switch {
+	case n < 0:
+		return false
+	case !ok && len(c.counts) >= maxAdvisoryShapes:
+		return false
+	}
+
+	n++
+	if n >= c.threshold {
+		c.counts[fingerprint] = -1
+		return true
+	}
+	c.counts[fingerprint] = n
+	return false
+}
+
+// registerPrepareAdvisory registers callbacks logging an advisory for shapes run threshold times.
+func registerPrepareAdvisory(gormDB *gorm.DB, threshold int) error {
+	advise := adviseShape(&shapeCounter{threshold: threshold, counts: make(map[string]int)})
+	cb := gormDB.Callback()
+	if err := cb.Create().After("gorm:create").Register("database:prepare_advisory", advise); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Register("database:prepare_advisory", advise); err != nil {
+		return err
+	}
+	if err := cb.Delete().After("gorm:delete").Register("database:prepare_advisory", advise); err != nil {
+		return err
+	}
+	if err := cb.Query().After("gorm:query").Register("database:prepare_advisory", advise); err != nil {
+		return err
+	}
+	if err := cb.Raw().After("gorm:raw").Register("database:prepare_advisory", advise); err != nil {
+		return err
+	}
+	return cb.Row().After("gorm:row").Register("database:prepare_advisory", advise)
+}
+
+// adviseShape returns a callback counting the statement's shape and logging the advisory.
+func adviseShape(counter *shapeCounter) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		if tx.Error != nil || tx.DryRun || tx.Statement.SQL.Len() == 0 {
+			return
+		}
+
+		fingerprint := Fingerprint(tx.Statement.SQL.String())
+		if counter.count(fingerprint) {
+			tx.Logger.Warn(tx.Statement.Context, "query shape ran %d times without prepared statements; consider Config.PrepareStmt: %s", counter.threshold, fingerprint)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Package database provides per-connection application names.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+Config.AppNameTemplate is expanded each time a pooled connection is opened and sent as its
+application_name, so a stuck session in pg_stat_activity can be traced back to the pod,
+process and even the connection that holds it. TxName still renames the session for the
+duration of a transaction; the template's value is restored when it ends.
+
+Placeholders:
+
+	{service}  $SERVICE_NAME, else $OTEL_SERVICE_NAME, else the executable's file name
+	{pod}      $POD_NAME, else $HOSTNAME
+	{host}     the host name reported by the kernel
+	{pid}      the process ID
+	{conn}     the number of the connection within the process, starting at 1
+
+A placeholder that cannot be resolved expands to "unknown", and unknown placeholders are
+kept as written. The server truncates application names to 63 bytes and replaces non-ASCII
+characters with question marks, so keep the most distinctive parts first.
+
+Example usage:
+
+	cfg.AppNameTemplate = "{service}-{pod}-{pid}-{conn}" // e.g. "billing-billing-7f9c-1-12"
+	db, _ := database.CreatePostgreSQL(cfg)
+*/
+
+package database
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// unresolvedPlaceholder is the value of AppNameTemplate placeholders that cannot be resolved.
+const unresolvedPlaceholder = "unknown"
+
+// connectionCount numbers the connections opened by the process for the {conn} placeholder.
+var connectionCount uint64
+
+// appNameHook returns a before-connect hook setting application_name to template, expanded
+// for each new connection.
+func appNameHook(template string) func(ctx context.Context, cfg *pgx.ConnConfig) error {
+	// Everything but {conn} is the same for every connection of the process.
+	static := strings.NewReplacer(
+		"{service}", firstNonEmpty(os.Getenv("SERVICE_NAME"), os.Getenv("OTEL_SERVICE_NAME"), executableName()),
+		"{pod}", firstNonEmpty(os.Getenv("POD_NAME"), os.Getenv("HOSTNAME")),
+		"{host}", firstNonEmpty(hostname()),
+		"{pid}", strconv.Itoa(os.Getpid()),
+	).Replace(template)
+
+	return func(ctx context.Context, cfg *pgx.ConnConfig) error {
+		name := strings.ReplaceAll(static, "{conn}", strconv.FormatUint(atomic.AddUint64(&connectionCount, 1), 10))
+
+		// cfg is a shallow copy shared with other connections; copy the map before changing it.
+		params := make(map[string]string, len(cfg.RuntimeParams)+1)
+		for k, v := range cfg.RuntimeParams {
+			params[k] = v
+		}
+		params["application_name"] = name
+		cfg.RuntimeParams = params
+		return nil
+	}
+}
+
+// firstNonEmpty returns the first non-empty value, or unresolvedPlaceholder.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return unresolvedPlaceholder
+}
+
+// executableName returns the file name of the running executable, or "" if unknown.
+func executableName() string {
+	path, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(path)
+}
+
+// hostname returns the host name reported by the kernel, or "" if unknown.
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,205 @@
+/*
+Package database provides scannable types for PostgreSQL array columns.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+IntArray and StringArray implement sql.Scanner and driver.Valuer, so one-dimensional
+bigint[] and text[] columns work on struct fields without wrapping values at every call
+site. A NULL column scans into a nil slice; a nil slice is written as NULL.
+
+Example usage:
+
+	type Post struct {
+	    ID      uint
+	    Tags    database.StringArray // text[]
+	    Ratings database.IntArray    // bigint[]
+	}
+
+	db.Create(&Post{Tags: database.StringArray{"go", "sql"}, Ratings: database.IntArray{5, 4}})
+*/
+
+package database
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// IntArray is a PostgreSQL integer array column, e.g. bigint[] or int[].
+type IntArray []int64
+
+// GormDataType returns the column type used by AutoMigrate.
+func (IntArray) GormDataType() string {
+	return "bigint[]"
+}
+
+// Scan implements sql.Scanner. NULL elements are rejected.
+func (a *IntArray) Scan(src interface{}) error {
+	elems, err := scanArray(src)
+	if err != nil || elems == nil {
+		*a = nil
+		return err
+	}
+
+	result := make(IntArray, len(elems))
+	for i, elem := range elems {
+		if elem == nil {
+			return fmt.Errorf("failed to scan int array; element %d is NULL", i)
+		}
+		n, err := strconv.ParseInt(*elem, 10, 64)
+		if err != nil {
+			return fmt.Errorf("failed to scan int array; %s", err.Error())
+		}
+		result[i] = n
+	}
+
+	*a = result
+	return nil
+}
+
+// Value implements driver.Valuer.
+func (a IntArray) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+
+	elems := make([]string, len(a))
+	for i, n := range a {
+		elems[i] = strconv.FormatInt(n, 10)
+	}
+	return "{" + strings.Join(elems, ",") + "}", nil
+}
+
+// StringArray is a PostgreSQL text array column, e.g. text[] or varchar[].
+type StringArray []string
+
+// GormDataType returns the column type used by AutoMigrate.
+func (StringArray) GormDataType() string {
+	return "text[]"
+}
+
+// Scan implements sql.Scanner. NULL elements are rejected.
+func (a *StringArray) Scan(src interface{}) error {
+	elems, err := scanArray(src)
+	if err != nil || elems == nil {
+		*a = nil
+		return err
+	}
+
+	result := make(StringArray, len(elems))
+	for i, elem := range elems {
+		if elem == nil {
+			return fmt.Errorf("failed to scan string array; element %d is NULL", i)
+		}
+		result[i] = *elem
+	}
+
+	*a = result
+	return nil
+}
+
+// Value implements driver.Valuer. Every element is quoted, so commas, quotes, braces,
+// backslashes and the word NULL are preserved as text.
+func (a StringArray) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+
+	elems := make([]string, len(a))
+	for i, s := range a {
+		elems[i] = quoteArrayElement(s)
+	}
+	return "{" + strings.Join(elems, ",") + "}", nil
+}
+
+// quoteArrayElement quotes s as an element of an array literal.
+func quoteArrayElement(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// scanArray parses the text representation of a one-dimensional array. It returns nil for
+// a NULL column and a nil element for each NULL element.
+func scanArray(src interface{}) ([]*string, error) {
+	var text string
+	switch v := src.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	default:
+		return nil, fmt.Errorf("failed to scan array; unsupported type %T", src)
+	}
+
+	elems, err := parseArray(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan array %q; %s", text, err.Error())
+	}
+	return elems, nil
+}
+
+// parseArray parses a one-dimensional array literal such as {1,"a b",NULL}.
+func parseArray(text string) ([]*string, error) {
+	if len(text) < 2 || text[0] != '{' || text[len(text)-1] != '}' {
+		return nil, fmt.Errorf("not an array literal")
+	}
+
+	body := text[1 : len(text)-1]
+	elems := make([]*string, 0)
+	if body == "" {
+		return elems, nil
+	}
+
+	for i := 0; ; {
+		var elem *string
+		switch {
+		case i < len(body) && body[i] == '{':
+			return nil, fmt.Errorf("multidimensional arrays are not supported")
+		case i < len(body) && body[i] == '"':
+			var b strings.Builder
+			i++
+			for ; i < len(body) && body[i] != '"'; i++ {
+				if body[i] == '\\' {
+					i++
+					if i == len(body) {
+						return nil, fmt.Errorf("unterminated escape")
+					}
+				}
+				b.WriteByte(body[i])
+			}
+			if i == len(body) {
+				return nil, fmt.Errorf("unterminated quoted element")
+			}
+			i++ // closing quote
+			s := b.String()
+			elem = &s
+		default:
+			end := strings.IndexByte(body[i:], ',')
+			if end < 0 {
+				end = len(body) - i
+			}
+			s := strings.TrimSpace(body[i : i+end])
+			i += end
+			if !strings.EqualFold(s, "NULL") {
+				elem = &s
+			}
+		}
+		elems = append(elems, elem)
+
+		if i == len(body) {
+			return elems, nil
+		}
+		if body[i] != ',' {
+			return nil, fmt.Errorf("unexpected %q after element", body[i])
+		}
+		i++
+	}
+}
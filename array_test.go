@@ -0,0 +1,132 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIntArrayRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		array   IntArray
+		literal interface{}
+	}{
+		{"NULL", nil, nil},
+		{"empty", IntArray{}, "{}"},
+		{"single", IntArray{42}, "{42}"},
+		{"negative", IntArray{-1, 0, -9223372036854775808, 9223372036854775807}, "{-1,0,-9223372036854775808,9223372036854775807}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := tt.array.Value()
+			if err != nil {
+				t.Fatalf("Value failed; %s", err.Error())
+			}
+			if value != tt.literal {
+				t.Errorf("Value = %#v; want %#v", value, tt.literal)
+			}
+
+			var scanned IntArray
+			if err := scanned.Scan(value); err != nil {
+				t.Fatalf("Scan failed; %s", err.Error())
+			}
+			if !reflect.DeepEqual(scanned, tt.array) {
+				t.Errorf("Scan = %#v; want %#v", scanned, tt.array)
+			}
+		})
+	}
+}
+
+func TestIntArrayScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     interface{}
+		want    IntArray
+		wantErr bool
+	}{
+		{"bytes", []byte("{1,-2,3}"), IntArray{1, -2, 3}, false},
+		{"NULL element", "{1,NULL}", nil, true},
+		{"not a number", "{1,a}", nil, true},
+		{"multidimensional", "{{1,2},{3,4}}", nil, true},
+		{"not an array", "1,2", nil, true},
+		{"unsupported type", 12, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var a IntArray
+			err := a.Scan(tt.src)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Scan error = %v; want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(a, tt.want) {
+				t.Errorf("Scan = %#v; want %#v", a, tt.want)
+			}
+		})
+	}
+}
+
+func TestStringArrayRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		array   StringArray
+		literal interface{}
+	}{
+		{"NULL", nil, nil},
+		{"empty", StringArray{}, "{}"},
+		{"plain", StringArray{"a", "b"}, `{"a","b"}`},
+		{"empty element", StringArray{""}, `{""}`},
+		{"comma", StringArray{"a,b"}, `{"a,b"}`},
+		{"quote", StringArray{`say "hi"`}, `{"say \"hi\""}`},
+		{"backslash", StringArray{`C:\tmp\`}, `{"C:\\tmp\\"}`},
+		{"word NULL", StringArray{"NULL", "null"}, `{"NULL","null"}`},
+		{"braces and spaces", StringArray{"{x}", " padded "}, `{"{x}"," padded "}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := tt.array.Value()
+			if err != nil {
+				t.Fatalf("Value failed; %s", err.Error())
+			}
+			if value != tt.literal {
+				t.Errorf("Value = %#v; want %#v", value, tt.literal)
+			}
+
+			var scanned StringArray
+			if err := scanned.Scan(value); err != nil {
+				t.Fatalf("Scan failed; %s", err.Error())
+			}
+			if !reflect.DeepEqual(scanned, tt.array) {
+				t.Errorf("Scan = %#v; want %#v", scanned, tt.array)
+			}
+		})
+	}
+}
+
+func TestStringArrayScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     interface{}
+		want    StringArray
+		wantErr bool
+	}{
+		// PostgreSQL only quotes elements that need it.
+		{"server output", `{a,"b,c","d\"e","f\\g","NULL",""}`, StringArray{"a", "b,c", `d"e`, `f\g`, "NULL", ""}, false},
+		{"bytes", []byte(`{x,y}`), StringArray{"x", "y"}, false},
+		{"NULL element", "{a,NULL}", nil, true},
+		{"unterminated quote", `{"a}`, nil, true},
+		{"unterminated escape", `{"a\`, nil, true},
+		{"garbage after element", `{"a"b}`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var a StringArray
+			err := a.Scan(tt.src)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Scan error = %v; want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(a, tt.want) {
+				t.Errorf("Scan = %#v; want %#v", a, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,398 @@
+/*
+Package database provides bulk write helpers for PostgreSQL connections.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+CreateIgnoringConflicts inserts a batch of records with ON CONFLICT DO NOTHING, so rows
+violating the conflict target are skipped instead of aborting the whole batch. It reports
+how many records were actually inserted, which makes idempotent bulk ingestion easy to
+monitor.
+
+Upsert inserts records and, for those conflicting with an existing row, updates the existing
+row instead. Assignments may take the incoming value, with Excluded, or combine it with the
+current one, with Increment, e.g. to merge counters.
+
+When the conflict target is a partial unique index, ON CONFLICT must repeat the index
+predicate, or PostgreSQL reports that no unique constraint matches. Pass ConflictWhere with
+the predicate to either helper.
+
+BulkUpdate updates many rows with different values in one UPDATE ... FROM (VALUES ...)
+statement instead of one statement per row. Every value is cast to the type of its column,
+read from the catalog, since the server cannot infer the types of bind parameters in a
+VALUES list.
+
+Example usage:
+
+	inserted, err := db.CreateIgnoringConflicts(ctx, &events, []string{"event_id"})
+	if err != nil {
+	    return err
+	}
+	skipped := int64(len(events)) - inserted
+
+	// INSERT ... ON CONFLICT ("page", "day") DO UPDATE SET "title"="excluded"."title",
+	//     "views"="page_views"."views" + "excluded"."views"
+	_, err = db.Upsert(ctx, &pageViews, []string{"page", "day"},
+	    append(database.Excluded("title"), database.Increment("views")...))
+
+	// CREATE UNIQUE INDEX ON users (email) WHERE deleted_at IS NULL
+	// INSERT ... ON CONFLICT ("email") WHERE deleted_at IS NULL DO UPDATE SET "name"="excluded"."name"
+	_, err = db.Upsert(ctx, &users, []string{"email"}, database.Excluded("name"),
+	    database.ConflictWhere("deleted_at IS NULL"))
+
+	// UPDATE "products" AS t SET "price" = v."price", "stock" = v."stock"
+	//     FROM (VALUES (CAST($1 AS bigint), CAST($2 AS numeric), CAST($3 AS integer)), ...)
+	//     AS v("id", "price", "stock") WHERE t."id" = v."id"
+	updated, err := db.BulkUpdate(ctx, "products", "id", []map[string]interface{}{
+	    {"id": 1, "price": "9.99", "stock": 12},
+	    {"id": 2, "price": "4.50", "stock": 0},
+	})
+*/
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CreateIgnoringConflicts inserts records, skipping those that conflict on conflictColumns,
+// and returns the number of records inserted. The number skipped is the number of records
+// minus the number inserted. Large slices are inserted in batches that stay under
+// PostgreSQL's bind parameter limit. No query is run when records is an empty slice.
+//
+// Parameters:
+//
+//	ctx (context.Context): Context of the insert. An ambient transaction from WithTransaction is joined.
+//	records (interface{}): Pointer to a slice of models, or to a single model.
+//	conflictColumns ([]string): Columns of the unique constraint forming the conflict target.
+//	  When empty, conflicts on any constraint are skipped.
+//	clauses (...clause.Expression): Additional clauses applied to every INSERT, e.g. clause.Returning{},
+//	  or ConflictWhere for a partial unique index.
+//
+// Returns:
+//
+//	inserted (int64): Number of records inserted.
+//	err (error): An error if the insert fails.
+//
+// Example:
+//
+//	db := database.New(...)
+//	inserted, err := db.CreateIgnoringConflicts(ctx, &users, []string{"email"})
+//	if err != nil {
+//	    fmt.Println("Error creating users:", err)
+//	}
+func (db *PostgreSQL) CreateIgnoringConflicts(ctx context.Context, records interface{}, conflictColumns []string, clauses ...clause.Expression) (inserted int64, err error) {
+	value := reflect.Indirect(reflect.ValueOf(records))
+	if value.Kind() == reflect.Slice && value.Len() == 0 {
+		return 0, nil
+	}
+
+	columns := make([]clause.Column, len(conflictColumns))
+	for i, name := range conflictColumns {
+		columns[i] = clause.Column{Name: name}
+	}
+	targetWhere, clauses := splitConflictWhere(clauses)
+
+	batchSize, err := db.createBatchSize(records)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create records; %s", err.Error())
+	}
+
+	result := db.Conn(ctx).
+		Clauses(append([]clause.Expression{clause.OnConflict{Columns: columns, TargetWhere: targetWhere, DoNothing: true}}, clauses...)...).
+		CreateInBatches(records, batchSize)
+	if result.Error != nil {
+		return result.RowsAffected, fmt.Errorf("failed to create records; %s", result.Error.Error())
+	}
+
+	return result.RowsAffected, nil
+}
+
+// createBatchSize returns the number of records of the given model that fit in one INSERT
+// without exceeding PostgreSQL's bind parameter limit.
+func (db *PostgreSQL) createBatchSize(records interface{}) (int, error) {
+	stmt := &gorm.Statement{DB: db.DB}
+	if err := stmt.Parse(records); err != nil {
+		return 0, err
+	}
+
+	columns := len(stmt.Schema.DBNames)
+	if columns == 0 {
+		columns = 1
+	}
+	return maxBindParameters / columns, nil
+}
+
+// Upsert inserts records and updates the existing row with assignments for those conflicting
+// on conflictColumns, returning the number of rows inserted or updated. Large slices are
+// upserted in batches that stay under PostgreSQL's bind parameter limit. No query is run when
+// records is an empty slice.
+//
+// Parameters:
+//
+//	ctx (context.Context): Context of the upsert. An ambient transaction from WithTransaction is joined.
+//	records (interface{}): Pointer to a slice of models, or to a single model.
+//	conflictColumns ([]string): Columns of the unique constraint forming the conflict target.
+//	assignments ([]clause.Assignment): Updates applied to conflicting rows, e.g. from Excluded and Increment.
+//	clauses (...clause.Expression): Additional clauses applied to every INSERT, e.g. clause.Returning{},
+//	  or ConflictWhere for a partial unique index.
+//
+// Returns:
+//
+//	int64: Number of rows inserted or updated.
+//	error: An error if the upsert fails.
+//
+// Example:
+//
+//	db := database.New(...)
+//	affected, err := db.Upsert(ctx, &counters, []string{"name"}, database.Increment("hits"))
+//	if err != nil {
+//	    fmt.Println("Error upserting counters:", err)
+//	}
+func (db *PostgreSQL) Upsert(ctx context.Context, records interface{}, conflictColumns []string, assignments []clause.Assignment, clauses ...clause.Expression) (int64, error) {
+	value := reflect.Indirect(reflect.ValueOf(records))
+	if value.Kind() == reflect.Slice && value.Len() == 0 {
+		return 0, nil
+	}
+	if len(conflictColumns) == 0 {
+		return 0, fmt.Errorf("failed to upsert records; no conflict columns given")
+	}
+	if len(assignments) == 0 {
+		return 0, fmt.Errorf("failed to upsert records; no assignments given")
+	}
+
+	columns := make([]clause.Column, len(conflictColumns))
+	for i, name := range conflictColumns {
+		columns[i] = clause.Column{Name: name}
+	}
+	targetWhere, clauses := splitConflictWhere(clauses)
+
+	batchSize, err := db.createBatchSize(records)
+	if err != nil {
+		return 0, fmt.Errorf("failed to upsert records; %s", err.Error())
+	}
+
+	result := db.Conn(ctx).
+		Clauses(append([]clause.Expression{clause.OnConflict{Columns: columns, TargetWhere: targetWhere, DoUpdates: assignments}}, clauses...)...).
+		CreateInBatches(records, batchSize)
+	if result.Error != nil {
+		return result.RowsAffected, fmt.Errorf("failed to upsert records; %s", result.Error.Error())
+	}
+
+	return result.RowsAffected, nil
+}
+
+// conflictWhere is the index predicate of a partial unique index used as conflict target.
+type conflictWhere string
+
+// Build writes the predicate. It is only used when the clause is passed outside of the bulk helpers.
+func (w conflictWhere) Build(builder clause.Builder) {
+	builder.WriteString(string(w))
+}
+
+// ConflictWhere returns a clause for CreateIgnoringConflicts and Upsert that adds predicate
+// to the conflict target, i.e. ON CONFLICT (columns) WHERE predicate, matching a partial
+// unique index with the same predicate. predicate is inserted as SQL verbatim and must not
+// contain user input.
+//
+// Example:
+//
+//	db := database.New(...)
+//	_, err := db.Upsert(ctx, &users, []string{"email"}, database.Excluded("name"),
+//	    database.ConflictWhere("deleted_at IS NULL"))
+func ConflictWhere(predicate string) clause.Expression {
+	return conflictWhere(predicate)
+}
+
+// splitConflictWhere returns the conflict target predicate given with ConflictWhere in
+// clauses, and the remaining clauses.
+func splitConflictWhere(clauses []clause.Expression) (clause.Where, []clause.Expression) {
+	var where clause.Where
+	remaining := make([]clause.Expression, 0, len(clauses))
+	for _, c := range clauses {
+		if predicate, ok := c.(conflictWhere); ok {
+			where.Exprs = append(where.Exprs, clause.Expr{SQL: string(predicate)})
+			continue
+		}
+		remaining = append(remaining, c)
+	}
+	return where, remaining
+}
+
+// Excluded returns upsert assignments setting each column to the incoming value, i.e.
+// "column" = EXCLUDED."column".
+func Excluded(columns ...string) []clause.Assignment {
+	return clause.AssignmentColumns(columns)
+}
+
+// Increment returns upsert assignments adding the incoming value to the existing one, i.e.
+// "column" = "table"."column" + EXCLUDED."column".
+func Increment(columns ...string) []clause.Assignment {
+	assignments := make([]clause.Assignment, len(columns))
+	for i, name := range columns {
+		assignments[i] = clause.Assignment{
+			Column: clause.Column{Name: name},
+			Value: clause.Expr{
+				SQL:  "? + ?",
+				Vars: []interface{}{clause.Column{Table: clause.CurrentTable, Name: name}, clause.Column{Table: "excluded", Name: name}},
+			},
+		}
+	}
+	return assignments
+}
+
+// BulkUpdate updates the rows of table whose keyColumn matches the key of an update, setting
+// the other columns of the update, in a single statement, and returns the number of rows
+// updated. Every update must set the same columns. Updates needing more than 65535 bind
+// parameters are run in several statements within one transaction. No query is run when
+// updates is empty.
+//
+// Parameters:
+//
+//	ctx (context.Context): Context of the update. An ambient transaction from WithTransaction is joined.
+//	table (string): Table to update, optionally schema-qualified. It is quoted.
+//	keyColumn (string): Column identifying the row to update, usually the primary key.
+//	updates ([]map[string]interface{}): Column values, each holding keyColumn and the columns to set.
+//	  Array values must be passed as driver.Valuer, e.g. StringArray, rather than as Go slices.
+//
+// Returns:
+//
+//	int64: Number of rows updated. Updates whose key matches no row are ignored.
+//	error: An error if the updates are invalid, a column does not exist or the update fails.
+//
+// Example:
+//
+//	db := database.New(...)
+//	updated, err := db.BulkUpdate(ctx, "users", "id", []map[string]interface{}{
+//	    {"id": 1, "name": "Ann", "active": true},
+//	    {"id": 2, "name": "Bob", "active": false},
+//	})
+//	if err != nil {
+//	    fmt.Println("Error updating users:", err)
+//	}
+func (db *PostgreSQL) BulkUpdate(ctx context.Context, table string, keyColumn string, updates []map[string]interface{}) (int64, error) {
+	if len(updates) == 0 {
+		return 0, nil
+	}
+
+	// The key column comes first, followed by the columns to set in a stable order.
+	columns := []string{keyColumn}
+	for name := range updates[0] {
+		if name != keyColumn {
+			columns = append(columns, name)
+		}
+	}
+	sort.Strings(columns[1:])
+	if len(columns) == 1 {
+		return 0, fmt.Errorf("failed to bulk update %s; no columns to set", table)
+	}
+	for i, update := range updates {
+		if _, ok := update[keyColumn]; !ok {
+			return 0, fmt.Errorf("failed to bulk update %s; update %d has no key column %s", table, i, keyColumn)
+		}
+		if len(update) != len(columns) {
+			return 0, fmt.Errorf("failed to bulk update %s; update %d sets %d columns, want %d", table, i, len(update)-1, len(columns)-1)
+		}
+		for _, name := range columns {
+			if _, ok := update[name]; !ok {
+				return 0, fmt.Errorf("failed to bulk update %s; update %d does not set column %s", table, i, name)
+			}
+		}
+	}
+
+	conn := db.Conn(ctx)
+	types, err := columnTypes(conn, table)
+	if err != nil {
+		return 0, fmt.Errorf("failed to bulk update %s; %s", table, err.Error())
+	}
+
+	quoted := make([]string, len(columns))
+	casts := make([]string, len(columns))
+	for i, name := range columns {
+		typ, ok := types[name]
+		if !ok {
+			return 0, fmt.Errorf("failed to bulk update %s; column %s does not exist", table, name)
+		}
+		quoted[i] = QuoteIdentifier(name)
+		casts[i] = "CAST(? AS " + typ + ")"
+	}
+
+	assignments := make([]string, len(columns)-1)
+	for i, name := range quoted[1:] {
+		assignments[i] = name + " = v." + name
+	}
+	row := "(" + strings.Join(casts, ", ") + ")"
+	prefix := "UPDATE " + quoteQualifiedName(table) + " AS t SET " + strings.Join(assignments, ", ") + " FROM (VALUES "
+	suffix := ") AS v(" + strings.Join(quoted, ", ") + ") WHERE t." + quoted[0] + " = v." + quoted[0]
+
+	batchSize := maxBindParameters / len(columns)
+	run := func(tx *gorm.DB) (int64, error) {
+		var updated int64
+		for start := 0; start < len(updates); start += batchSize {
+			end := start + batchSize
+			if end > len(updates) {
+				end = len(updates)
+			}
+
+			rows := make([]string, 0, end-start)
+			vars := make([]interface{}, 0, (end-start)*len(columns))
+			for _, update := range updates[start:end] {
+				rows = append(rows, row)
+				for _, name := range columns {
+					vars = append(vars, update[name])
+				}
+			}
+
+			result := tx.Exec(prefix+strings.Join(rows, ", ")+suffix, vars...)
+			if result.Error != nil {
+				return updated, result.Error
+			}
+			updated += result.RowsAffected
+		}
+		return updated, nil
+	}
+
+	var updated int64
+	if len(updates) <= batchSize {
+		updated, err = run(conn)
+	} else {
+		err = conn.Transaction(func(tx *gorm.DB) error {
+			updated, err = run(tx)
+			return err
+		})
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to bulk update %s; %s", table, err.Error())
+	}
+
+	return updated, nil
+}
+
+// columnTypes returns the types of the columns of table, without type modifiers, so a value
+// cast to its column type is still checked against the column's length or precision.
+func columnTypes(conn *gorm.DB, table string) (map[string]string, error) {
+	var columns []struct {
+		Name string
+		Type string
+	}
+	err := conn.Raw(`SELECT attname AS name, format_type(atttypid, NULL) AS type FROM pg_attribute
+		WHERE attrelid = ?::regclass AND attnum > 0 AND NOT attisdropped`, quoteQualifiedName(table)).Scan(&columns).Error
+	if err != nil {
+		return nil, err
+	}
+
+	types := make(map[string]string, len(columns))
+	for _, c := range columns {
+		types[c.Name] = c.Type
+	}
+	return types, nil
+}
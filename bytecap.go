@@ -0,0 +1,120 @@
+/*
+Package database provides result size caps for PostgreSQL queries.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+A session returned by WithByteCap aborts a query once the rows it has read exceed a byte
+budget, bounding the memory a query can take even when a few rows carry large text, bytea
+or jsonb values. Sizes are measured on the decoded values: the length of strings and byte
+slices, and 8 bytes for every other value.
+
+Example usage:
+
+	var events []Event
+	err := db.WithByteCap(64 << 20).Where("tenant_id = ?", tenant).Find(&events).Error
+	if errors.Is(err, database.ErrByteCapExceeded) {
+	    return fmt.Errorf("export too large, narrow the time range: %w", err)
+	}
+
+Notes:
+  - Caps apply to Find, First, Scan, Row and Rows, not to statements run with Exec.
+  - Caps are not enforced for prepared statements cached with Config.PrepareStmt.
+*/
+
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/gorm"
+)
+
+// ErrByteCapExceeded is returned when a query reads more bytes than allowed by WithByteCap.
+var ErrByteCapExceeded = errors.New("result exceeds byte cap")
+
+// byteCapSetting is the statement setting holding the byte cap of a session.
+const byteCapSetting = "database:byte_cap"
+
+// byteCapKey is the context key under which the byte cap of a running query is stored.
+type byteCapKey struct{}
+
+// WithByteCap returns a session whose queries fail with ErrByteCapExceeded once the rows read
+// exceed n bytes. The budget applies to each query separately. The session can be reused;
+// conditions added to one statement do not carry over to the next.
+//
+// Example:
+//
+//	db := database.New(...)
+//	var docs []Document
+//	err := db.WithByteCap(10 << 20).Find(&docs).Error
+func (db *PostgreSQL) WithByteCap(n int64) *gorm.DB {
+	return db.DB.Set(byteCapSetting, n).Session(&gorm.Session{})
+}
+
+// registerByteCap registers callbacks passing the byte cap of a session to its queries.
+func registerByteCap(gormDB *gorm.DB) error {
+	cb := gormDB.Callback()
+	if err := cb.Query().Before("gorm:query").Register("database:byte_cap", applyByteCap); err != nil {
+		return err
+	}
+	return cb.Row().Before("gorm:row").Register("database:byte_cap", applyByteCap)
+}
+
+// applyByteCap stores the session's byte cap in the statement context, where the driver
+// connection picks it up.
+func applyByteCap(tx *gorm.DB) {
+	if n, ok := tx.Get(byteCapSetting); ok {
+		if max, ok := n.(int64); ok {
+			tx.Statement.Context = context.WithValue(tx.Statement.Context, byteCapKey{}, max)
+		}
+	}
+}
+
+// cappedRows are rows failing with ErrByteCapExceeded once more than max bytes are read.
+type cappedRows struct {
+	*stdlib.Rows
+	max  int64
+	read int64
+}
+
+// capRows wraps rows with the byte cap carried by ctx, if any.
+func capRows(ctx context.Context, rows driver.Rows) driver.Rows {
+	max, ok := ctx.Value(byteCapKey{}).(int64)
+	if !ok {
+		return rows
+	}
+	stdRows, ok := rows.(*stdlib.Rows)
+	if !ok {
+		return rows
+	}
+	return &cappedRows{Rows: stdRows, max: max}
+}
+
+// Next reads the next row, failing once the rows read exceed the cap.
+func (r *cappedRows) Next(dest []driver.Value) error {
+	if err := r.Rows.Next(dest); err != nil {
+		return err
+	}
+
+	for _, v := range dest {
+		switch v := v.(type) {
+		case []byte:
+			r.read += int64(len(v))
+		case string:
+			r.read += int64(len(v))
+		default:
+			r.read += 8
+		}
+	}
+	if r.read > r.max {
+		return fmt.Errorf("%w; read %d bytes, cap is %d", ErrByteCapExceeded, r.read, r.max)
+	}
+	return nil
+}
@@ -23,7 +23,7 @@ Example usage:
         Timezone:          "Asia/Jakarta",
     }
 
-    fmt.Println(cfg.DSN()) // Output: "user=user password=password dbname=mydatabase port=5432 host=localhost sslmode=disable TimeZone=Asia/Jakarta"
+    fmt.Println(cfg.DSN()) // Output: "user=user password=password dbname=mydatabase port=5432 host=localhost sslmode=disable TimeZone=Asia/Jakarta connect_timeout=10"
 
     fmt.Println(cfg.String()) // Output: "user=user password=password dbname=mydatabase port=5432 host=localhost min-pool=2 max-pool=10"
 
@@ -31,18 +31,93 @@ Example usage:
 
 package database
 
-import "fmt"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DefaultConnectTimeout is the connect timeout used when Config.ConnectTimeout is unset.
+const DefaultConnectTimeout = 10 * time.Second
+
+// ConnectFunc is called with every new pooled connection before it is used.
+type ConnectFunc func(ctx context.Context, conn *pgx.Conn) error
+
+// DisconnectFunc is called with every pooled connection about to be closed.
+type DisconnectFunc func(conn *pgx.Conn)
 
 // Config holds configuration parameters for connecting to a database.
 type Config struct {
-	Host              string // Database host address.
-	Port              int    // Database port number.
-	User              string // Database user name.
-	Pass              string // Database password.
-	Name              string // Database name.
-	MaxConnectionPool int    // Maximum size of the connection pool. Set to <= 0 for unlimited connections. Default is 0.
-	MinConnectionPool int    // Minimum size of the connection pool. Set to <= 0 for no connection pooling. Default is 0.
-	Timezone          string // Timezone of the database server. Default is "Asia/Jakarta".
+	Host                     string              // Database host address, or the directory of a unix domain socket when it begins with "/", e.g. "/cloudsql/project:region:instance".
+	Port                     int                 // Database port number. May be 0 for unix domain sockets to use the default socket file.
+	User                     string              // Database user name.
+	Pass                     string              // Database password.
+	PassFile                 string              // File holding the database password, e.g. a mounted Kubernetes or Docker secret, used instead of Pass. A trailing newline is trimmed. Default is "".
+	Name                     string              // Database name.
+	Schema                   string              // Schema set as the search_path of every session, so unqualified names resolve in it. Default is "", keeping the server setting.
+	CreateSchemaIfMissing    bool                // Create Schema with CREATE SCHEMA IF NOT EXISTS on connect. Requires the CREATE privilege on the database. Default is false.
+	AppNameTemplate          string              // application_name of every connection, expanded when it is opened, e.g. "{service}-{pod}-{pid}-{conn}". Placeholders are {service}, {pod}, {host}, {pid} and {conn}; unresolved ones expand to "unknown". Default is "", leaving application_name unset.
+	MaxConnectionPool        int                 // Maximum size of the connection pool. Set to <= 0 for unlimited connections. Default is 0.
+	AutoPoolSize             bool                // Derive MaxConnectionPool from the CPU count (runtime.NumCPU()*2 + 1) when it is <= 0, instead of allowing unlimited connections. Default is false.
+	MinConnectionPool        int                 // Minimum size of the connection pool. Set to <= 0 for no connection pooling. Default is 0.
+	Timezone                 string              // Session time zone, resolved by the server, so no tzdata is needed on the client. Default is "Asia/Jakarta".
+	ConnectTimeout           time.Duration       // Maximum time to wait while establishing a connection, rounded up to whole seconds. Default is 10s.
+	GSSEncMode               string              // libpq gssencmode: "disable", "prefer" or "require". The pgx driver never negotiates GSSAPI encryption, so "require" is rejected on connect. Default is "", keeping libpq's default.
+	ChannelBinding           string              // libpq channel_binding: "disable", "prefer" or "require". The pgx driver does not support SCRAM channel binding, so "require" is rejected on connect. Default is "", keeping libpq's default.
+	PrepareStmt              bool                // Cache prepared statements for reuse. Disables the simple protocol. Cannot be combined with ReplicaDSNs or NamedReplicas. Default is false.
+	PreparedStmtTTL          time.Duration       // Interval at which the prepared statement cache is cleared. Set to <= 0 to never clear. Default is 0.
+	PrepareAdvisoryThreshold int                 // Without PrepareStmt, log a one-time advisory for each query shape run this many times. Set to <= 0 to disable. Default is 0.
+	ExtendedProtocol         bool                // Without PrepareStmt, send arguments as bind parameters of unnamed statements instead of interpolating them into the SQL, so pg_stat_statements records the same $1 shapes as with PrepareStmt. Works behind PgBouncer. Default is false.
+	SlowTransactionThreshold time.Duration       // Transactions started by WithTransaction that take longer than this overall are logged as warnings, even when each statement is fast. Set to <= 0 to disable. Default is 0.
+	DefaultQueryTimeout      time.Duration       // Timeout applied to statements whose context has no deadline. Statements with a deadline are unchanged. Set to <= 0 to disable. Default is 0.
+	AcquireTimeout           time.Duration       // Maximum time a statement waits for a free pooled connection before failing with ErrPoolExhausted. Set to <= 0 to wait indefinitely. Default is 0.
+	MaxConcurrentQueries     int                 // Maximum number of statements running or waiting for a connection at once. Statements beyond it fail immediately with ErrTooBusy. Set to <= 0 to disable. Default is 0.
+	IdleInTransactionTimeout time.Duration       // Sessions idle inside an open transaction longer than this are terminated by the server. Does not affect idle pooled connections. Set to <= 0 to disable. Default is 0.
+	ReplicaDSNs              []string            // DSNs of read replicas that serve reads for every query. Default is none.
+	NamedReplicas            map[string][]string // DSNs of replica groups that only serve queries pinned with Source, keyed by group name. Default is none.
+	TrackActor               bool                // Populate created_by and updated_by columns from the actor stored with WithActor. Default is false.
+	RequireActor             bool                // Reject tracked writes without an actor in the context with ErrNoActor instead of skipping them. Default is false.
+	AuditDDL                 bool                // Log every successful CREATE, ALTER and DROP statement at Warn level with the actor stored with WithActor. Default is false.
+	ReconnectSQLStates       []string            // SQLSTATEs after which a connection is discarded and the statement retried by database/sql, up to three attempts in total, e.g. FailoverSQLStates. Default is none.
+	ExplainThreshold         time.Duration       // Queries slower than this have their plan captured with EXPLAIN and logged. Set to <= 0 to disable. Default is 0.
+	ExplainSampleRate        float64             // Fraction of slow queries whose plan is captured. Set to <= 0 or >= 1 to capture every slow query. Default is 0.
+	ExplainSampleSeed        int64               // Seed for plan sampling, for reproducible tests. Set to 0 to seed from the current time. Default is 0.
+	ClientEncoding           string              // Character set, e.g. "LATIN1", that the server converts every string sent and received on the connection to and from. Default is "", meaning UTF8.
+	SynchronousCommit        *bool               // Sets synchronous_commit for every session. False trades durability for write speed: commits acknowledged shortly before a crash may be lost. Default is nil, keeping the server setting.
+	OnConnect                ConnectFunc         // Called for every new pooled connection before it is used, e.g. to set session settings. An error discards the connection. Default is nil.
+	GenerateUUID             UUIDFunc            // Generates zero UUID primary keys on create, e.g. NewUUIDv7 or NewUUIDv4. Default is nil, leaving keys to the application or the database.
+	EnablePrometheus         bool                // Export metrics with the gorm Prometheus plugin, configured by Prometheus. Default is false.
+	Prometheus               PrometheusConfig    // Settings of the Prometheus plugin. Only used with EnablePrometheus. Default is the zero value.
+	Metrics                  Metrics             // Receives measurements such as transaction outcomes and durations. Default is nil, recording nothing.
+	OnDisconnect             DisconnectFunc      // Called when a pooled connection is closed, before it is closed. Default is nil.
+}
+
+// password returns Pass, or the contents of PassFile when it is set.
+func (cfg Config) password() (string, error) {
+	if cfg.PassFile == "" {
+		return cfg.Pass, nil
+	}
+
+	content, err := os.ReadFile(cfg.PassFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// isUTF8 reports whether connections use the UTF8 client encoding.
+func (cfg Config) isUTF8() bool {
+	switch strings.ToUpper(cfg.ClientEncoding) {
+	case "", "UTF8", "UTF-8", "UNICODE":
+		return true
+	}
+	return false
 }
 
 // String returns a formatted string representation of the Config, including connection details and pool settings.
@@ -54,9 +129,129 @@ func (cfg Config) String() string {
 }
 
 // DSN returns the Data Source Name (DSN) string used for connecting to the database.
+// For unix domain sockets the port is omitted when it is 0, letting libpq pick the default socket file.
+// Optional fields are omitted when empty: password, e.g. for trust or peer authentication, and
+// TimeZone, leaving the server's default in effect. User, dbname, host and sslmode always appear.
 func (cfg Config) DSN() string {
-	return fmt.Sprintf(
-		"user=%s password=%s dbname=%s port=%d host=%s sslmode=disable TimeZone=%s",
-		cfg.User, cfg.Pass, cfg.Name, cfg.Port, cfg.Host, cfg.Timezone,
-	)
+	dsn := "user=" + cfg.User
+	if pass, _ := cfg.password(); pass != "" {
+		dsn += " password=" + pass
+	}
+	dsn += " dbname=" + cfg.Name
+	if !cfg.IsSocket() || cfg.Port > 0 {
+		dsn += fmt.Sprintf(" port=%d", cfg.Port)
+	}
+	dsn += fmt.Sprintf(" host=%s sslmode=disable", cfg.Host)
+	if cfg.Timezone != "" {
+		dsn += " TimeZone=" + cfg.Timezone
+	}
+
+	connectTimeout := cfg.ConnectTimeout
+	if connectTimeout <= 0 {
+		connectTimeout = DefaultConnectTimeout
+	}
+	dsn += fmt.Sprintf(" connect_timeout=%d", int64(math.Ceil(connectTimeout.Seconds())))
+
+	// Sent as a run-time parameter in the startup message, applying to every session.
+	if cfg.IdleInTransactionTimeout > 0 {
+		dsn += fmt.Sprintf(" idle_in_transaction_session_timeout=%d", cfg.IdleInTransactionTimeout.Milliseconds())
+	}
+	if cfg.ClientEncoding != "" {
+		dsn += " client_encoding=" + cfg.ClientEncoding
+	}
+	// Connection options for libpq-based tools reading the DSN; see openPool for pgx.
+	if cfg.GSSEncMode != "" {
+		dsn += " gssencmode=" + cfg.GSSEncMode
+	}
+	if cfg.ChannelBinding != "" {
+		dsn += " channel_binding=" + cfg.ChannelBinding
+	}
+	if cfg.Schema != "" {
+		dsn += " search_path=" + quoteDSNValue(QuoteIdentifier(cfg.Schema))
+	}
+	if cfg.SynchronousCommit != nil {
+		if *cfg.SynchronousCommit {
+			dsn += " synchronous_commit=on"
+		} else {
+			dsn += " synchronous_commit=off"
+		}
+	}
+
+	return dsn
+}
+
+// quoteDSNValue quotes value for a keyword/value DSN.
+func quoteDSNValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	return "'" + strings.ReplaceAll(value, "'", `\'`) + "'"
+}
+
+// IsSocket reports whether Host is the directory of a unix domain socket rather than a host name.
+func (cfg Config) IsSocket() bool {
+	return strings.HasPrefix(cfg.Host, "/")
+}
+
+// Validate checks that the Config holds the parameters required to connect. A unix domain
+// socket directory is accepted in place of a host name, in which case Port may be 0.
+func (cfg Config) Validate() error {
+	if cfg.Host == "" {
+		return fmt.Errorf("invalid config; host is required")
+	}
+	if cfg.IsSocket() {
+		if cfg.Port < 0 || cfg.Port > 65535 {
+			return fmt.Errorf("invalid config; port %d out of range", cfg.Port)
+		}
+	} else if cfg.Port <= 0 || cfg.Port > 65535 {
+		return fmt.Errorf("invalid config; port %d out of range", cfg.Port)
+	}
+	if cfg.User == "" {
+		return fmt.Errorf("invalid config; user is required")
+	}
+	if cfg.Name == "" {
+		return fmt.Errorf("invalid config; database name is required")
+	}
+	if cfg.PassFile != "" {
+		if cfg.Pass != "" {
+			return fmt.Errorf("invalid config; pass and pass file are mutually exclusive")
+		}
+		if _, err := cfg.password(); err != nil {
+			return fmt.Errorf("invalid config; failed to read pass file; %s", err.Error())
+		}
+	}
+	if !isLibpqMode(cfg.GSSEncMode) {
+		return fmt.Errorf("invalid config; gss enc mode %q is not disable, prefer or require", cfg.GSSEncMode)
+	}
+	if !isLibpqMode(cfg.ChannelBinding) {
+		return fmt.Errorf("invalid config; channel binding %q is not disable, prefer or require", cfg.ChannelBinding)
+	}
+	if cfg.CreateSchemaIfMissing && cfg.Schema == "" {
+		return fmt.Errorf("invalid config; create schema if missing requires a schema")
+	}
+	if cfg.MaxConnectionPool > 0 && cfg.MinConnectionPool > cfg.MaxConnectionPool {
+		return fmt.Errorf("invalid config; min pool %d exceeds max pool %d", cfg.MinConnectionPool, cfg.MaxConnectionPool)
+	}
+	if cfg.PrepareStmt && cfg.hasReplicas() {
+		return errPrepareStmtWithReplicas
+	}
+	return nil
+}
+
+// errPrepareStmtWithReplicas rejects Config.PrepareStmt together with replicas. dbresolver
+// caches the prepared statements of the replicas itself, out of reach of
+// ClearPreparedStatements and Config.PreparedStmtTTL, so the caches would grow unbounded.
+var errPrepareStmtWithReplicas = errors.New("invalid config; prepare stmt cannot be combined with replicas")
+
+// hasReplicas reports whether the Config lists any replica.
+func (cfg Config) hasReplicas() bool {
+	return len(cfg.ReplicaDSNs) > 0 || len(cfg.NamedReplicas) > 0
+}
+
+// isLibpqMode reports whether mode is empty or one of the libpq modes of gssencmode and
+// channel_binding.
+func isLibpqMode(mode string) bool {
+	switch mode {
+	case "", "disable", "prefer", "require":
+		return true
+	}
+	return false
 }
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPrepareStmtWithReplicasRejected(t *testing.T) {
+	base := Config{Host: "localhost", Port: 5432, User: "app", Name: "app", PrepareStmt: true}
+
+	withReplicas := base
+	withReplicas.ReplicaDSNs = []string{"host=replica-1"}
+	withNamed := base
+	withNamed.NamedReplicas = map[string][]string{"analytics": {"host=analytics-1"}}
+
+	for name, cfg := range map[string]Config{"ReplicaDSNs": withReplicas, "NamedReplicas": withNamed} {
+		t.Run(name, func(t *testing.T) {
+			if err := cfg.Validate(); !errors.Is(err, errPrepareStmtWithReplicas) {
+				t.Errorf("Validate() = %v; want %v", err, errPrepareStmtWithReplicas)
+			}
+			if _, err := CreatePostgreSQL(&cfg); !errors.Is(err, errPrepareStmtWithReplicas) {
+				t.Errorf("CreatePostgreSQL() = %v; want %v", err, errPrepareStmtWithReplicas)
+			}
+		})
+	}
+
+	if err := base.Validate(); err != nil {
+		t.Errorf("Validate() without replicas = %v; want nil", err)
+	}
+}
+
+func TestConfigDSNOptionalFields(t *testing.T) {
+	base := Config{Host: "localhost", Port: 5432, User: "app", Name: "appdb"}
+
+	tests := []struct {
+		name      string
+		pass      string
+		timezone  string
+		want      []string
+		wantEmpty []string
+	}{
+		{"all set", "secret", "UTC", []string{"password=secret", "TimeZone=UTC"}, nil},
+		{"no password", "", "UTC", []string{"TimeZone=UTC"}, []string{"password="}},
+		{"no timezone", "secret", "", []string{"password=secret"}, []string{"TimeZone="}},
+		{"neither", "", "", nil, []string{"password=", "TimeZone="}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := base
+			cfg.Pass = tt.pass
+			cfg.Timezone = tt.timezone
+			dsn := cfg.DSN()
+
+			for _, field := range append(tt.want, "user=app", "dbname=appdb", "port=5432", "host=localhost", "sslmode=disable") {
+				if !strings.Contains(dsn, field) {
+					t.Errorf("DSN %q lacks %q", dsn, field)
+				}
+			}
+			for _, field := range tt.wantEmpty {
+				if strings.Contains(dsn, field) {
+					t.Errorf("DSN %q contains %q", dsn, field)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Package database provides registration of custom type converters.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+Domain types such as money amounts or geographic points often live in packages that should
+not depend on database/sql, so they cannot implement sql.Scanner and driver.Valuer
+themselves. RegisterType registers a pair of conversion functions for such a type as a gorm
+serializer; fields tagged with the serializer's name are then converted transparently by
+every query, create and update. Register types once at startup, e.g. in an init function
+of the data access package, so every service converts them the same way.
+
+Example usage:
+
+	database.RegisterType("money",
+	    func(src interface{}) (money.Amount, error) {
+	        s, _ := src.(string) // numeric columns are scanned as text
+	        return money.Parse(s)
+	    },
+	    func(a money.Amount) (driver.Value, error) {
+	        return a.String(), nil
+	    },
+	)
+
+	type Invoice struct {
+	    ID    uint
+	    Total money.Amount  `gorm:"type:numeric(12,2);serializer:money"`
+	    Tip   *money.Amount `gorm:"type:numeric(12,2);serializer:money"` // NULL scans to nil
+	}
+*/
+
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm/schema"
+)
+
+// RegisterType registers scan and value as the gorm serializer name for fields of type T or
+// *T. scan converts a value read from the database and value converts a field value for
+// writing. A NULL column sets *T fields to nil without calling scan; for T fields scan is
+// called with nil. A nil *T is written as NULL. Registering a name again replaces the
+// previous converter.
+//
+// Parameters:
+//
+//	name (string): Serializer name used in the field tag, e.g. `gorm:"serializer:money"`.
+//	scan (func(src interface{}) (T, error)): Converts a database value, e.g. a string or []byte.
+//	value (func(v T) (driver.Value, error)): Converts a field value to a database value.
+//
+// Example:
+//
+//	database.RegisterType("point", scanPoint, func(p geo.Point) (driver.Value, error) {
+//	    return fmt.Sprintf("(%f,%f)", p.X, p.Y), nil
+//	})
+func RegisterType[T any](name string, scan func(src interface{}) (T, error), value func(v T) (driver.Value, error)) {
+	schema.RegisterSerializer(name, converter[T]{name: name, scan: scan, value: value})
+}
+
+// converter is a gorm serializer converting fields of type T or *T with functions.
+type converter[T any] struct {
+	name  string
+	scan  func(src interface{}) (T, error)
+	value func(v T) (driver.Value, error)
+}
+
+// Scan converts dbValue and stores it in the field of dst.
+func (c converter[T]) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue interface{}) error {
+	target := field.ReflectValueOf(ctx, dst)
+	pointer := field.FieldType.Kind() == reflect.Ptr
+	if pointer && dbValue == nil {
+		target.Set(reflect.Zero(field.FieldType))
+		return nil
+	}
+
+	v, err := c.scan(dbValue)
+	if err != nil {
+		return fmt.Errorf("failed to scan %s into %s; %s", c.name, field.Name, err.Error())
+	}
+
+	converted := reflect.ValueOf(&v)
+	if !pointer {
+		converted = converted.Elem()
+	}
+	if !converted.Type().AssignableTo(field.FieldType) {
+		return fmt.Errorf("failed to scan %s into %s; field type is %s", c.name, field.Name, field.FieldType)
+	}
+	target.Set(converted)
+	return nil
+}
+
+// Value converts fieldValue for writing to the database.
+func (c converter[T]) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue interface{}) (interface{}, error) {
+	switch v := fieldValue.(type) {
+	case T:
+		return c.value(v)
+	case *T:
+		if v == nil {
+			return nil, nil
+		}
+		return c.value(*v)
+	}
+	return nil, fmt.Errorf("failed to convert %s from %s; unsupported type %T", c.name, field.Name, fieldValue)
+}
@@ -0,0 +1,73 @@
+/*
+Package database provides fast approximate row counts for PostgreSQL tables.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+An exact COUNT(*) reads every visible row, which takes seconds to minutes on large tables.
+EstimatedCount instead reads the row estimate the planner keeps in pg_class, which costs a
+single catalog lookup regardless of the table's size. It is meant for dashboards and
+pagination controls, where "about 12.4 million" is as good as the exact number.
+
+Example usage:
+
+	total, err := db.EstimatedCount(ctx, "events")
+	if err != nil {
+	    return err
+	}
+	fmt.Printf("about %d events\n", total)
+
+Notes:
+  - The estimate is only as fresh as the table's statistics, which VACUUM, ANALYZE and
+    autovacuum refresh. Like the planner, EstimatedCount scales the last row density to the
+    table's current size, so growth since then is mostly accounted for, but the estimate can
+    still be off after heavy updates or deletes. Run Analyze for a fresh estimate.
+  - A table that has never been vacuumed or analyzed has no estimate, and 0 is returned.
+  - A partitioned table has no rows of its own; count its partitions instead.
+*/
+
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// estimatedCountQuery scales the row density of the last statistics to the current number of
+// pages, as the planner does. A negative reltuples means the table was never analyzed.
+const estimatedCountQuery = `SELECT (CASE
+	WHEN reltuples < 0 THEN 0
+	WHEN relpages = 0 THEN reltuples
+	ELSE reltuples / relpages * (pg_relation_size(oid) / current_setting('block_size')::float8)
+END)::bigint FROM pg_class WHERE oid = ?::regclass`
+
+// EstimatedCount returns the approximate number of rows of table from the planner statistics,
+// without scanning the table. See the package notes on how fresh the estimate is.
+//
+// Parameters:
+//
+//	ctx (context.Context): Context of the query. An ambient transaction from WithTransaction is joined.
+//	table (string): Table to count, optionally schema-qualified, e.g. "sales.orders". It is
+//	  quoted, so it is case-sensitive and may come from configuration.
+//
+// Returns:
+//
+//	int64: Estimated number of rows, or 0 if the table has no statistics yet.
+//	error: An error if the table does not exist or the query fails.
+//
+// Example:
+//
+//	db := database.New(...)
+//	count, err := db.EstimatedCount(ctx, "orders")
+//	if err != nil {
+//	    fmt.Println("Error estimating orders:", err)
+//	}
+func (db *PostgreSQL) EstimatedCount(ctx context.Context, table string) (int64, error) {
+	var count int64
+	if err := db.Conn(ctx).Raw(estimatedCountQuery, quoteQualifiedName(table)).Scan(&count).Error; err != nil {
+		return 0, fmt.Errorf("failed to estimate row count of %s; %s", table, err.Error())
+	}
+	return count, nil
+}
@@ -0,0 +1,89 @@
+/*
+Package database provides auditing of DDL statements.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+When Config.AuditDDL is enabled, every CREATE, ALTER or DROP statement executed successfully
+through the connection, including those run by AutoMigrate and migrations, is logged at Warn
+level with the actor stored in the context with WithActor. The lines stand out from DML
+tracing, so schema changes made outside the normal migration flow can be traced to who made
+them.
+
+Example usage:
+
+	cfg.AuditDDL = true
+	db, _ := database.CreatePostgreSQL(cfg)
+
+	ctx := database.WithActor(ctx, "alice@example.com")
+	db.WithContext(ctx).Exec("DROP INDEX orders_status_idx")
+	// [warn] ddl by alice@example.com: DROP INDEX orders_status_idx
+*/
+
+package database
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// registerDDLAudit registers callbacks logging successful DDL statements.
+func registerDDLAudit(gormDB *gorm.DB) error {
+	return gormDB.Callback().Raw().After("gorm:raw").Register("database:audit_ddl", auditDDL)
+}
+
+// auditDDL logs the statement at Warn level with the actor from the context if it is DDL.
+func auditDDL(tx *gorm.DB) {
+	if tx.Error != nil || tx.DryRun {
+		return
+	}
+
+	sql := tx.Statement.SQL.String()
+	if !isDDL(sql) {
+		return
+	}
+
+	actor, ok := ActorFromContext(tx.Statement.Context)
+	if !ok {
+		actor = "unknown actor"
+	}
+	tx.Logger.Warn(tx.Statement.Context, "ddl by %v: %s", actor, sql)
+}
+
+// isDDL reports whether the first keyword of sql, after leading whitespace and comments, is
+// CREATE, ALTER or DROP.
+func isDDL(sql string) bool {
+	i := 0
+	for i < len(sql) {
+		switch {
+		case sql[i] == ' ' || sql[i] == '\t' || sql[i] == '\n' || sql[i] == '\r':
+			i++
+		case strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				return false
+			}
+			i += end + 1
+		case strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return false
+			}
+			i += end + 4
+		default:
+			end := i
+			for end < len(sql) && isWordByte(sql[end]) {
+				end++
+			}
+			switch strings.ToUpper(sql[i:end]) {
+			case "CREATE", "ALTER", "DROP":
+				return true
+			}
+			return false
+		}
+	}
+	return false
+}
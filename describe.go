@@ -0,0 +1,165 @@
+/*
+Package database provides result column descriptions for PostgreSQL queries.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+DescribeQuery prepares a query without executing it and reports the columns it would return,
+so a generic query tool can render input and output widgets before running the query.
+
+Example usage:
+
+	columns, err := db.DescribeQuery(ctx, "SELECT id, email, created_at FROM users WHERE id = ?", 0)
+	for _, c := range columns {
+	    fmt.Println(c.Name, c.DatabaseTypeName) // id INT8, email VARCHAR, created_at TIMESTAMPTZ
+	}
+*/
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// ColumnType describes a result column of a query.
+type ColumnType struct {
+	Name             string // Column name or alias.
+	DatabaseTypeName string // Upper-case type name, e.g. "INT8" or "VARCHAR", or the type OID for types unknown to the driver such as enums.
+	Nullable         *bool  // Whether the column may be NULL, from the NOT NULL constraint of its source column. Nil when unknown, e.g. for expressions.
+	Length           int64  // Maximum length of varchar(n) and char(n) columns, math.MaxInt64 for text and bytea, 0 for other types.
+}
+
+// DescribeQuery returns the result columns of query without executing it or fetching any rows.
+// The query is only prepared, on a dedicated pooled connection. args are used to build the
+// placeholders the same way as for Raw, e.g. a slice expands to a list; their values are
+// not sent.
+//
+// Nullability is derived from the source column of each result column. A NOT NULL column
+// read from the nullable side of an outer join can still be NULL.
+//
+// Parameters:
+//
+//	ctx (context.Context): Context bounding the preparation.
+//	sql (string): Query to describe, with ? placeholders as for Raw.
+//	args (...interface{}): Arguments of the placeholders.
+//
+// Returns:
+//
+//	[]ColumnType: Result columns in order. Empty for statements returning no rows.
+//	error: An error if the query cannot be prepared.
+//
+// Example:
+//
+//	db := database.New(...)
+//	columns, err := db.DescribeQuery(ctx, "SELECT * FROM orders WHERE status IN ?", []string{"open"})
+//	if err != nil {
+//	    fmt.Println("Invalid query:", err)
+//	}
+func (db *PostgreSQL) DescribeQuery(ctx context.Context, sql string, args ...interface{}) ([]ColumnType, error) {
+	stmt := db.DB.Raw(sql, args...).Statement
+	if stmt.Error != nil {
+		return nil, fmt.Errorf("failed to describe query; %s", stmt.Error.Error())
+	}
+
+	var columns []ColumnType
+	err := db.withPgxConn(ctx, func(conn *pgx.Conn) error {
+		sd, err := conn.Prepare(ctx, "", stmt.SQL.String())
+		if err != nil {
+			return err
+		}
+
+		columns = make([]ColumnType, len(sd.Fields))
+		for i, field := range sd.Fields {
+			columns[i] = ColumnType{
+				Name:             field.Name,
+				DatabaseTypeName: databaseTypeName(conn.TypeMap(), field.DataTypeOID),
+				Length:           columnLength(field.DataTypeOID, field.TypeModifier),
+			}
+		}
+		return describeNullability(ctx, conn, sd.Fields, columns)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe query; %s", err.Error())
+	}
+
+	return columns, nil
+}
+
+// databaseTypeName returns the upper-case name of the type with oid, or the oid itself for
+// types unknown to the driver.
+func databaseTypeName(typeMap *pgtype.Map, oid uint32) string {
+	if t, ok := typeMap.TypeForOID(oid); ok {
+		return strings.ToUpper(t.Name)
+	}
+	return strconv.FormatUint(uint64(oid), 10)
+}
+
+// columnLength returns the maximum length of a column of type oid with modifier typeModifier.
+func columnLength(oid uint32, typeModifier int32) int64 {
+	switch oid {
+	case pgtype.TextOID, pgtype.ByteaOID:
+		return math.MaxInt64
+	case pgtype.VarcharOID, pgtype.BPCharOID:
+		// The modifier includes the 4-byte varlena header; -1 means no limit.
+		if typeModifier < 0 {
+			return math.MaxInt64
+		}
+		return int64(typeModifier - 4)
+	}
+	return 0
+}
+
+// describeNullability sets the Nullable field of the columns read directly from a table column
+// from the NOT NULL constraint of that column.
+func describeNullability(ctx context.Context, conn *pgx.Conn, fields []pgconn.FieldDescription, columns []ColumnType) error {
+	var relations, attributes []int64
+	for _, field := range fields {
+		if field.TableOID != 0 {
+			relations = append(relations, int64(field.TableOID))
+			attributes = append(attributes, int64(field.TableAttributeNumber))
+		}
+	}
+	if len(relations) == 0 {
+		return nil
+	}
+
+	rows, err := conn.Query(ctx, `SELECT a.attrelid::int8, a.attnum::int8, a.attnotnull
+		FROM pg_attribute a
+		JOIN unnest($1::int8[], $2::int8[]) AS c(rel, num) ON a.attrelid = c.rel::oid AND a.attnum = c.num`,
+		relations, attributes)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	notNull := make(map[[2]int64]bool)
+	for rows.Next() {
+		var relation, attribute int64
+		var value bool
+		if err := rows.Scan(&relation, &attribute, &value); err != nil {
+			return err
+		}
+		notNull[[2]int64{relation, attribute}] = value
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i, field := range fields {
+		if value, ok := notNull[[2]int64{int64(field.TableOID), int64(field.TableAttributeNumber)}]; ok {
+			nullable := !value
+			columns[i].Nullable = &nullable
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+/*
+Package database provides helpers for managing native PostgreSQL enum types.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+GORM scans and writes enum columns as plain strings, but the enum type itself must exist
+before AutoMigrate creates a column that references it. RegisterEnum creates the type
+when it is missing and is safe to call on every start-up.
+
+Mapping a Go type to an enum:
+
+	type OrderStatus string
+
+	const (
+	    OrderPending OrderStatus = "pending"
+	    OrderPaid    OrderStatus = "paid"
+	)
+
+	type Order struct {
+	    ID     uint
+	    Status OrderStatus `gorm:"type:order_status;not null"`
+	}
+
+	if err := db.RegisterEnum("order_status", "pending", "paid"); err != nil {
+	    return err
+	}
+	if err := db.AutoMigrate(&Order{}); err != nil {
+	    return err
+	}
+
+Any Go type whose underlying type is string works without a custom Scanner or Valuer.
+*/
+
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// SQLSTATE raised by CREATE TYPE when the type already exists.
+const sqlStateDuplicateObject = "42710"
+
+// RegisterEnum creates the PostgreSQL enum type name with the given values if it does not
+// already exist. Calling it again for an existing type is a no-op; the values of an existing
+// type are not altered.
+//
+// Parameters:
+//
+//	name (string): Name of the enum type, e.g. "order_status".
+//	values (...string): Labels of the enum, in sort order. At least one is required.
+//
+// Returns:
+//
+//	error: An error if checking for or creating the type fails.
+//
+// Example:
+//
+//	db := database.New(...)
+//	err := db.RegisterEnum("order_status", "pending", "paid", "shipped")
+//	if err != nil {
+//	    fmt.Println("Error registering enum:", err)
+//	}
+func (db *PostgreSQL) RegisterEnum(name string, values ...string) error {
+	if name == "" {
+		return fmt.Errorf("failed to register enum; name is empty")
+	}
+	if len(values) == 0 {
+		return fmt.Errorf("failed to register enum %s; no values given", name)
+	}
+
+	var exists bool
+	err := db.DB.Raw(
+		"SELECT EXISTS (SELECT 1 FROM pg_type WHERE typname = ? AND pg_type_is_visible(oid))", name,
+	).Scan(&exists).Error
+	if err != nil {
+		return fmt.Errorf("failed to check enum %s; %s", name, err.Error())
+	}
+	if exists {
+		return nil
+	}
+
+	labels := make([]string, len(values))
+	for i, v := range values {
+		labels[i] = quoteLiteral(v)
+	}
+
+	stmt := fmt.Sprintf("CREATE TYPE %s AS ENUM (%s)", QuoteIdentifier(name), strings.Join(labels, ", "))
+	if err := db.DB.Exec(stmt).Error; err != nil {
+		// Another process may have created the type between the check and the create.
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == sqlStateDuplicateObject {
+			return nil
+		}
+		return fmt.Errorf("failed to create enum %s; %s", name, err.Error())
+	}
+
+	return nil
+}
+
+// QuoteIdentifier quotes name as a PostgreSQL identifier, doubling embedded double quotes, so
+// table and column names supplied by callers can be used in dynamic SQL without injection.
+// The quoted identifier is case-sensitive and is not split on dots; quote each part of a
+// qualified name separately.
+//
+// Example:
+//
+//	stmt := fmt.Sprintf("SELECT count(*) FROM %s.%s", database.QuoteIdentifier(schema), database.QuoteIdentifier(table))
+func QuoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// quoteLiteral quotes s as a PostgreSQL string literal.
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
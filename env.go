@@ -0,0 +1,218 @@
+/*
+Package database provides configuration from environment variables.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+ConfigFromEnv builds a Config from environment variables sharing a prefix, so a deployment
+can configure the connection, including read replicas, without code changes. Variables that
+are unset or empty keep the Config defaults.
+
+	PREFIX_HOST            Host
+	PREFIX_PORT            Port
+	PREFIX_USER            User
+	PREFIX_PASS            Pass
+	PREFIX_PASS_FILE       PassFile
+	PREFIX_NAME            Name
+	PREFIX_MAX_POOL        MaxConnectionPool
+	PREFIX_MIN_POOL        MinConnectionPool
+	PREFIX_TIMEZONE        Timezone
+	PREFIX_REPLICA_DSNS    ReplicaDSNs, separated by commas
+
+Other variables with the prefix are ignored, so a typo such as PREFIX_TIMEZON silently keeps
+the default. ConfigFromEnvStrict rejects them instead, naming the closest known variable.
+
+Example usage:
+
+	// DB_HOST=primary.internal DB_PORT=5432 DB_USER=app DB_NAME=shop
+	// DB_REPLICA_DSNS="host=replica-1.internal user=app dbname=shop,host=replica-2.internal user=app dbname=shop"
+	cfg, err := database.ConfigFromEnv("DB")
+	if err != nil {
+	    log.Fatal(err)
+	}
+	db, err := database.CreatePostgreSQL(cfg)
+
+	// DB_TIMEZON=UTC
+	_, err = database.ConfigFromEnvStrict("DB")
+	// failed to read config; unknown variables DB_TIMEZON (did you mean DB_TIMEZONE?)
+*/
+
+package database
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// envSettings are the settings read by ConfigFromEnv, as suffixes of the variable names. Keep
+// in sync with ConfigFromEnv.
+var envSettings = []string{"HOST", "PORT", "USER", "PASS", "PASS_FILE", "NAME", "MAX_POOL", "MIN_POOL", "TIMEZONE", "REPLICA_DSNS"}
+
+// ConfigFromEnv returns a Config read from the environment variables named prefix followed by
+// an underscore and the setting, e.g. "DB_HOST" for prefix "DB". Each replica DSN is parsed to
+// reject malformed values early; an empty or missing PREFIX_REPLICA_DSNS means no replicas.
+//
+// Parameters:
+//
+//	prefix (string): Prefix of the variable names, without the trailing underscore.
+//
+// Returns:
+//
+//	*Config: Configuration read from the environment. It is not validated; call Validate.
+//	error: An error if a variable holds a malformed number or DSN.
+//
+// Example:
+//
+//	cfg, err := database.ConfigFromEnv("ORDERS_DB")
+//	if err != nil {
+//	    fmt.Println("Error reading database config:", err)
+//	}
+func ConfigFromEnv(prefix string) (*Config, error) {
+	env := func(key string) (string, string) {
+		name := prefix + "_" + key
+		return name, strings.TrimSpace(os.Getenv(name))
+	}
+	envInt := func(key string, dest *int) error {
+		name, value := env(key)
+		if value == "" {
+			return nil
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("failed to read %s; %s", name, err.Error())
+		}
+		*dest = n
+		return nil
+	}
+
+	cfg := &Config{}
+	_, cfg.Host = env("HOST")
+	_, cfg.User = env("USER")
+	_, cfg.Pass = env("PASS")
+	_, cfg.PassFile = env("PASS_FILE")
+	_, cfg.Name = env("NAME")
+	_, cfg.Timezone = env("TIMEZONE")
+	if err := envInt("PORT", &cfg.Port); err != nil {
+		return nil, err
+	}
+	if err := envInt("MAX_POOL", &cfg.MaxConnectionPool); err != nil {
+		return nil, err
+	}
+	if err := envInt("MIN_POOL", &cfg.MinConnectionPool); err != nil {
+		return nil, err
+	}
+
+	name, replicas := env("REPLICA_DSNS")
+	dsns, err := parseReplicaDSNs(replicas)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s; %s", name, err.Error())
+	}
+	cfg.ReplicaDSNs = dsns
+
+	return cfg, nil
+}
+
+// ConfigFromEnvStrict is like ConfigFromEnv, but fails when an environment variable starting
+// with prefix and an underscore is not a known setting, e.g. a misspelled DB_TIMEZON, instead
+// of ignoring it. Variables of other tools sharing the prefix are rejected as well.
+//
+// Parameters:
+//
+//	prefix (string): Prefix of the variable names, without the trailing underscore.
+//
+// Returns:
+//
+//	*Config: Configuration read from the environment. It is not validated; call Validate.
+//	error: An error naming every unknown variable, or an error if a variable holds a malformed
+//	  number or DSN.
+//
+// Example:
+//
+//	cfg, err := database.ConfigFromEnvStrict("ORDERS_DB")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+func ConfigFromEnvStrict(prefix string) (*Config, error) {
+	known := make(map[string]bool, len(envSettings))
+	for _, key := range envSettings {
+		known[prefix+"_"+key] = true
+	}
+
+	var unknown []string
+	for _, entry := range os.Environ() {
+		name, _, _ := strings.Cut(entry, "=")
+		if !strings.HasPrefix(name, prefix+"_") || known[name] {
+			continue
+		}
+		if suggestion := closestEnvSetting(prefix, name); suggestion != "" {
+			name += " (did you mean " + suggestion + "?)"
+		}
+		unknown = append(unknown, name)
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("failed to read config; unknown variables %s", strings.Join(unknown, ", "))
+	}
+
+	return ConfigFromEnv(prefix)
+}
+
+// closestEnvSetting returns the known variable whose name is at most two edits away from
+// name, or "" if there is none.
+func closestEnvSetting(prefix, name string) string {
+	best, bestDistance := "", 3
+	for _, key := range envSettings {
+		candidate := prefix + "_" + key
+		if d := editDistance(name, candidate); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// parseReplicaDSNs splits a comma-separated list of keyword/value DSNs, skipping empty entries,
+// and checks that each one parses. URLs listing several hosts contain commas and cannot be
+// used. Errors name the position of the DSN rather than its contents, which may include a
+// password.
+func parseReplicaDSNs(list string) ([]string, error) {
+	var dsns []string
+	for i, dsn := range strings.Split(list, ",") {
+		dsn = strings.TrimSpace(dsn)
+		if dsn == "" {
+			continue
+		}
+		if _, err := pgconn.ParseConfig(dsn); err != nil {
+			return nil, fmt.Errorf("replica dsn %d is malformed", i+1)
+		}
+		dsns = append(dsns, dsn)
+	}
+	return dsns, nil
+}
@@ -0,0 +1,112 @@
+/*
+Package database provides driver-independent errors for PostgreSQL connections.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+Normalize maps gorm and pgx errors to the sentinel errors of this package, so callers can
+check for common failures with errors.Is without importing gorm or the driver. The original
+error stays in the chain and remains available to errors.As, e.g. for *pgconn.PgError.
+
+Example usage:
+
+	err := database.Normalize(db.WithContext(ctx).Create(&user).Error)
+	switch {
+	case errors.Is(err, database.ErrDuplicate):
+	    fmt.Println("user already exists")
+	case err != nil:
+	    fmt.Println("failed to create user:", err)
+	}
+*/
+
+package database
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// Errors returned by Normalize.
+var (
+	ErrNotFound      = errors.New("no matching record")
+	ErrDuplicate     = errors.New("duplicate key")
+	ErrForeignKey    = errors.New("foreign key violation")
+	ErrDeadlock      = errors.New("deadlock detected")
+	ErrSerialization = errors.New("serialization failure")
+	ErrLockTimeout   = errors.New("lock not available")
+)
+
+// SQLSTATEs mapped by Normalize.
+const (
+	sqlStateUniqueViolation      = "23505"
+	sqlStateForeignKeyViolation  = "23503"
+	sqlStateDeadlockDetected     = "40P01"
+	sqlStateSerializationFailure = "40001"
+	sqlStateLockNotAvailable     = "55P03"
+)
+
+// Normalize wraps err with the sentinel error matching its cause: ErrNotFound, ErrDuplicate,
+// ErrForeignKey, ErrDeadlock, ErrSerialization or ErrLockTimeout. ErrLockTimeout covers both
+// lock_timeout expiring and NOWAIT locks failing. Errors with any other cause, already
+// normalized errors and nil are returned unchanged.
+//
+// Parameters:
+//
+//	err (error): Error returned by gorm or the driver.
+//
+// Returns:
+//
+//	error: err wrapped with the matching sentinel error, or err itself.
+//
+// Example:
+//
+//	db := database.New(...)
+//	err := database.Normalize(db.First(&user, id).Error)
+//	if errors.Is(err, database.ErrNotFound) {
+//	    fmt.Println("No such user")
+//	}
+func Normalize(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	sentinel := sentinelError(err)
+	if sentinel == nil || errors.Is(err, sentinel) {
+		return err
+	}
+	return fmt.Errorf("%w; %w", sentinel, err)
+}
+
+// sentinelError returns the sentinel error matching the cause of err, or nil.
+func sentinelError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case sqlStateUniqueViolation:
+			return ErrDuplicate
+		case sqlStateForeignKeyViolation:
+			return ErrForeignKey
+		case sqlStateDeadlockDetected:
+			return ErrDeadlock
+		case sqlStateSerializationFailure:
+			return ErrSerialization
+		case sqlStateLockNotAvailable:
+			return ErrLockTimeout
+		}
+	}
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrNotFound
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return ErrDuplicate
+	case errors.Is(err, gorm.ErrForeignKeyViolated):
+		return ErrForeignKey
+	}
+	return nil
+}
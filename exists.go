@@ -0,0 +1,62 @@
+/*
+Package database provides existence checks for PostgreSQL connections.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+Exists reports whether any row matches a set of conditions with SELECT EXISTS, which stops
+at the first matching row and loads no columns, instead of fetching a row with First and
+checking for ErrRecordNotFound or counting every match with Count. Conditions take the same
+forms as the inline conditions of First and Find, and soft-deleted rows are excluded as usual.
+
+Example usage:
+
+	taken, err := db.Exists(ctx, &User{}, "email = ?", email)
+	// SELECT EXISTS (SELECT 1 FROM "users" WHERE email = $1 AND "users"."deleted_at" IS NULL)
+*/
+
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// Exists reports whether a row of model's table matches conds.
+//
+// Parameters:
+//
+//	ctx (context.Context): Context of the query. An ambient transaction from WithTransaction is joined.
+//	model (interface{}): Model whose table is checked, e.g. &User{}.
+//	conds (...interface{}): Conditions, e.g. "email = ?", email, a primary key or a struct. When
+//	  empty, Exists reports whether the table has any row.
+//
+// Returns:
+//
+//	bool: True if at least one row matches.
+//	error: An error if the query fails.
+//
+// Example:
+//
+//	db := database.New(...)
+//	exists, err := db.Exists(ctx, &Order{}, "customer_id = ? AND status = ?", customerID, "open")
+//	if err != nil {
+//	    fmt.Println("Error checking orders:", err)
+//	}
+func (db *PostgreSQL) Exists(ctx context.Context, model interface{}, conds ...interface{}) (bool, error) {
+	conn := db.Conn(ctx)
+
+	subquery := conn.Model(model).Select("1")
+	if len(conds) > 0 {
+		subquery = subquery.Where(conds[0], conds[1:]...)
+	}
+
+	var exists bool
+	if err := conn.Raw("SELECT EXISTS (?)", subquery).Scan(&exists).Error; err != nil {
+		return false, fmt.Errorf("failed to check existence; %s", err.Error())
+	}
+
+	return exists, nil
+}
@@ -0,0 +1,123 @@
+/*
+Package database provides sampled capture of query plans for slow queries.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+When Config.ExplainThreshold is set, queries running longer than the threshold have their
+plan captured with EXPLAIN and logged at Warn level. Capturing a plan is itself a round-trip,
+so when many queries are slightly over the threshold only the fraction given by
+Config.ExplainSampleRate is explained. Config.ExplainSampleSeed makes the sampling
+reproducible, e.g. in tests.
+
+Example usage:
+
+	cfg.ExplainThreshold = 500 * time.Millisecond
+	cfg.ExplainSampleRate = 0.1 // explain one in ten slow queries
+	db, _ := database.CreatePostgreSQL(cfg)
+
+Notes:
+  - Plans are captured with EXPLAIN, which plans the statement without running it again.
+  - Only queries issued through Find, First, Take and similar are explained; Row, Rows and
+    Scan are not.
+*/
+
+package database
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// explainStartKey is the statement instance key holding the time a query started.
+const explainStartKey = "database:explain_start"
+
+// planSampler decides which slow queries get their plan captured.
+type planSampler struct {
+	mu   sync.Mutex
+	rate float64
+	rnd  *rand.Rand
+}
+
+// newPlanSampler returns a sampler selecting the given fraction of queries. Rates <= 0 or
+// >= 1 select every query. A zero seed seeds from the current time.
+func newPlanSampler(rate float64, seed int64) *planSampler {
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &planSampler{rate: rate, rnd: rand.New(rand.NewSource(seed))}
+}
+
+// sample reports whether the next slow query should be explained.
+func (s *planSampler) sample() bool {
+	if s.rate <= 0 || s.rate >= 1 {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rnd.Float64() < s.rate
+}
+
+// registerExplain registers callbacks capturing the plan of sampled queries slower than threshold.
+func registerExplain(gormDB *gorm.DB, threshold time.Duration, sampler *planSampler) error {
+	capture := explainSlowQuery(threshold, sampler)
+	cb := gormDB.Callback()
+	if err := cb.Query().Before("gorm:query").Register("database:explain_start", startExplainClock); err != nil {
+		return err
+	}
+	// Row and Rows are not explained: their rows are still open on the connection when the
+	// callback chain ends.
+	return cb.Query().After("gorm:query").Register("database:explain", capture)
+}
+
+// startExplainClock records the time the query started.
+func startExplainClock(tx *gorm.DB) {
+	tx.InstanceSet(explainStartKey, time.Now())
+}
+
+// explainSlowQuery returns a callback logging the plan of sampled queries slower than threshold.
+func explainSlowQuery(threshold time.Duration, sampler *planSampler) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		v, ok := tx.InstanceGet(explainStartKey)
+		if !ok || tx.Error != nil || tx.Statement.SQL.Len() == 0 {
+			return
+		}
+
+		elapsed := time.Since(v.(time.Time))
+		if elapsed < threshold || !sampler.sample() {
+			return
+		}
+
+		ctx := tx.Statement.Context
+		sql := tx.Statement.SQL.String()
+		rows, err := tx.Statement.ConnPool.QueryContext(ctx, "EXPLAIN "+sql, tx.Statement.Vars...)
+		if err != nil {
+			tx.Logger.Warn(ctx, "failed to explain slow query; %s", err.Error())
+			return
+		}
+		defer rows.Close()
+
+		var plan []string
+		for rows.Next() {
+			var line string
+			if err := rows.Scan(&line); err != nil {
+				tx.Logger.Warn(ctx, "failed to read query plan; %s", err.Error())
+				return
+			}
+			plan = append(plan, line)
+		}
+		if err := rows.Err(); err != nil {
+			tx.Logger.Warn(ctx, "failed to read query plan; %s", err.Error())
+			return
+		}
+
+		tx.Logger.Warn(ctx, "plan for slow query [%.3fms] %s\n%s", float64(elapsed.Nanoseconds())/1e6, sql, strings.Join(plan, "\n"))
+	}
+}
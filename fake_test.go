@@ -0,0 +1,150 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// fakeConnector is a database/sql connector whose connections record the statements they
+// receive instead of sending them to a server. Queries return no rows.
+type fakeConnector struct {
+	mu         sync.Mutex
+	statements []string
+	args       [][]driver.NamedValue // arguments of each statement
+
+	// handle, if set, returns the error of each statement; nil succeeds.
+	handle func(ctx context.Context, query string) error
+}
+
+// Connect implements driver.Connector.
+func (c *fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{connector: c}, nil
+}
+
+// Driver implements driver.Connector.
+func (c *fakeConnector) Driver() driver.Driver {
+	return fakeDriver{}
+}
+
+// run records query and args and returns the result of handle.
+func (c *fakeConnector) run(ctx context.Context, query string, args []driver.NamedValue) error {
+	c.mu.Lock()
+	c.statements = append(c.statements, query)
+	c.args = append(c.args, args)
+	handle := c.handle
+	c.mu.Unlock()
+
+	if handle != nil {
+		return handle(ctx, query)
+	}
+	return nil
+}
+
+// sent returns the statements received so far.
+func (c *fakeConnector) sent() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.statements...)
+}
+
+// sentArgs returns the arguments of the statements received so far.
+func (c *fakeConnector) sentArgs() [][]driver.NamedValue {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([][]driver.NamedValue(nil), c.args...)
+}
+
+// fakeDriver is the driver of fakeConnector. Connections are only opened through the connector.
+type fakeDriver struct{}
+
+// Open implements driver.Driver.
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("fake driver: open connections through the connector")
+}
+
+// fakeConn is a connection of fakeConnector.
+type fakeConn struct {
+	connector *fakeConnector
+}
+
+// Prepare implements driver.Conn. Statements are run through ExecContext and QueryContext instead.
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("fake driver: prepared statements are not supported")
+}
+
+// Close implements driver.Conn.
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+// Begin implements driver.Conn.
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return fakeTx{}, nil
+}
+
+// ExecContext implements driver.ExecerContext.
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := c.connector.run(ctx, query, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(0), nil
+}
+
+// QueryContext implements driver.QueryerContext.
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := c.connector.run(ctx, query, args); err != nil {
+		return nil, err
+	}
+	return fakeRows{}, nil
+}
+
+// fakeTx is a transaction of fakeConn.
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+// fakeRows is an empty result set.
+type fakeRows struct{}
+
+func (fakeRows) Columns() []string         { return nil }
+func (fakeRows) Close() error              { return nil }
+func (fakeRows) Next([]driver.Value) error { return io.EOF }
+
+// newFakeDB returns a database whose primary pool is backed by a fakeConnector.
+func newFakeDB(t testing.TB) (*PostgreSQL, *fakeConnector) {
+	t.Helper()
+
+	connector := &fakeConnector{}
+	sqlDB := sql.OpenDB(connector)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{
+		Logger:                 logger.Discard,
+		SkipDefaultTransaction: true,
+		DisableAutomaticPing:   true,
+	})
+	if err != nil {
+		t.Fatalf("failed to open fake database; %s", err.Error())
+	}
+
+	return &PostgreSQL{DB: gormDB, done: make(chan struct{})}, connector
+}
+
+// newDryRunDB returns a database that builds statements without running them.
+func newDryRunDB(t testing.TB) *PostgreSQL {
+	t.Helper()
+
+	db, _ := newFakeDB(t)
+	db.DB = db.DB.Session(&gorm.Session{DryRun: true})
+	return db
+}
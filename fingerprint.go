@@ -0,0 +1,220 @@
+/*
+Package database provides SQL fingerprinting for grouping statements by shape.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+Fingerprint reduces a statement to its shape: literals and bind placeholders become ?, lists
+of them collapse to a single ?, comments are dropped and whitespace is normalized. Statements
+that differ only in their values share a fingerprint, so logs and metrics can be aggregated
+per query shape.
+
+Example usage:
+
+	database.Fingerprint("SELECT * FROM users WHERE id IN (1, 2, 3) AND name = 'bob'")
+	// SELECT * FROM users WHERE id IN (?) AND name = ?
+*/
+
+package database
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Lists of two or more placeholders, e.g. "(?, ?)", and of parenthesized placeholders, e.g.
+// the rows "(?),(?)" of a multi-row VALUES list once their columns have collapsed.
+var (
+	placeholderList = regexp.MustCompile(`\?(?:\s*,\s*\?)+`)
+	rowList         = regexp.MustCompile(`\(\?\)(?:\s*,\s*\(\?\))+`)
+)
+
+// Fingerprint returns the shape of the SQL statement sql, with literals replaced by ?.
+// Quoted identifiers and keywords are kept as written. A sign directly after an operator,
+// comma or opening parenthesis belongs to the number, so "x = -1" and "x = 1" share a shape.
+func Fingerprint(sql string) string {
+	var b strings.Builder
+	b.Grow(len(sql))
+
+	space := func() {
+		if b.Len() > 0 && !strings.HasSuffix(b.String(), " ") {
+			b.WriteByte(' ')
+		}
+	}
+
+	for i := 0; i < len(sql); {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			space()
+			i++
+		case strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				end = len(sql) - i
+			}
+			space()
+			i += end
+		case strings.HasPrefix(sql[i:], "/*"):
+			i = skipBlockComment(sql, i)
+			space()
+		case c == '\'':
+			i = skipQuoted(sql, i, false)
+			b.WriteByte('?')
+		case (c == 'e' || c == 'E') && i+1 < len(sql) && sql[i+1] == '\'' && !endsWithWord(sql[:i]):
+			i = skipQuoted(sql, i+1, true)
+			b.WriteByte('?')
+		case c == '"':
+			next := len(sql)
+			if end := strings.IndexByte(sql[i+1:], '"'); end >= 0 {
+				next = i + end + 2
+			}
+			b.WriteString(sql[i:next])
+			i = next
+		case c == '$' && !endsWithWord(sql[:i]):
+			if n := leadingDigits(sql[i+1:]); n > 0 {
+				b.WriteByte('?')
+				i += n + 1
+			} else if tag, ok := dollarQuoteTag(sql[i:]); ok {
+				end := strings.Index(sql[i+len(tag):], tag)
+				if end < 0 {
+					i = len(sql)
+				} else {
+					i += len(tag) + end + len(tag)
+				}
+				b.WriteByte('?')
+			} else {
+				b.WriteByte(c)
+				i++
+			}
+		case (c == '-' || c == '+') && startsNumber(sql[i+1:]) && !endsWithOperand(b.String()):
+			i += 1 + numberLength(sql[i+1:])
+			b.WriteByte('?')
+		case startsNumber(sql[i:]) && !endsWithWord(sql[:i]):
+			i += numberLength(sql[i:])
+			b.WriteByte('?')
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+
+	fingerprint := placeholderList.ReplaceAllString(strings.TrimSpace(b.String()), "?")
+	return rowList.ReplaceAllString(fingerprint, "(?)")
+}
+
+// skipQuoted returns the index after the string literal whose opening quote is at start.
+// Doubled quotes are always escapes; backslashes are escapes in E'...' strings.
+func skipQuoted(sql string, start int, backslashEscapes bool) int {
+	for i := start + 1; i < len(sql); i++ {
+		switch {
+		case backslashEscapes && sql[i] == '\\':
+			i++
+		case sql[i] == '\'':
+			if i+1 < len(sql) && sql[i+1] == '\'' {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(sql)
+}
+
+// skipBlockComment returns the index after the block comment starting at start. Block
+// comments nest, as in PostgreSQL: "/* a /* b */ c */" is a single comment.
+func skipBlockComment(sql string, start int) int {
+	depth := 0
+	for i := start; i+1 < len(sql); {
+		switch {
+		case sql[i] == '/' && sql[i+1] == '*':
+			depth++
+			i += 2
+		case sql[i] == '*' && sql[i+1] == '/':
+			if depth--; depth == 0 {
+				return i + 2
+			}
+			i += 2
+		default:
+			i++
+		}
+	}
+	return len(sql)
+}
+
+// dollarQuoteTag returns the opening tag of a dollar-quoted string at the start of s, e.g. $$ or $fn$.
+// A tag cannot start with a digit, so placeholders such as $1 are not tags.
+func dollarQuoteTag(s string) (string, bool) {
+	if len(s) > 1 && isDigit(s[1]) {
+		return "", false
+	}
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '$':
+			return s[:i+1], true
+		case !isWordByte(s[i]):
+			return "", false
+		}
+	}
+	return "", false
+}
+
+// startsNumber reports whether s starts with a numeric literal, e.g. "1" or ".5".
+func startsNumber(s string) bool {
+	if len(s) > 1 && s[0] == '.' {
+		return isDigit(s[1])
+	}
+	return len(s) > 0 && isDigit(s[0])
+}
+
+// endsWithOperand reports whether the fingerprint written so far ends with an operand, after
+// which a sign is a binary operator, e.g. the "a" of "a - 1" or the ")" of "(a) + 1".
+func endsWithOperand(fingerprint string) bool {
+	fingerprint = strings.TrimRight(fingerprint, " ")
+	if fingerprint == "" {
+		return false
+	}
+	c := fingerprint[len(fingerprint)-1]
+	return isWordByte(c) || c == ')' || c == ']' || c == '?' || c == '"'
+}
+
+// numberLength returns the length of the numeric literal at the start of s.
+func numberLength(s string) int {
+	i := leadingDigits(s)
+	if i < len(s) && s[i] == '.' {
+		i += 1 + leadingDigits(s[i+1:])
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		j := i + 1
+		if j < len(s) && (s[j] == '+' || s[j] == '-') {
+			j++
+		}
+		if n := leadingDigits(s[j:]); n > 0 {
+			i = j + n
+		}
+	}
+	return i
+}
+
+// leadingDigits returns the number of decimal digits at the start of s.
+func leadingDigits(s string) int {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return i
+}
+
+// endsWithWord reports whether s ends with an identifier character, e.g. the "t" before the
+// "1" of "t1".
+func endsWithWord(s string) bool {
+	return len(s) > 0 && isWordByte(s[len(s)-1])
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isWordByte(c byte) bool {
+	return c == '_' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
@@ -0,0 +1,61 @@
+package database
+
+import "testing"
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want string
+	}{
+		{"string literal", "SELECT * FROM users WHERE name = 'bob'", "SELECT * FROM users WHERE name = ?"},
+		{"doubled quote", "SELECT 'it''s'", "SELECT ?"},
+		{"escape string", `SELECT E'a\'b' AS x`, "SELECT ? AS x"},
+		{"escape string after identifier", `SELECT name'x'`, "SELECT name?"},
+		{"dollar quote", "SELECT $$a ' b$$", "SELECT ?"},
+		{"tagged dollar quote", "SELECT $fn$ $$ ; $fn$", "SELECT ?"},
+		{"placeholders", "SELECT * FROM t WHERE a = $1 AND b = $2", "SELECT * FROM t WHERE a = ? AND b = ?"},
+		{"quoted identifier", `SELECT "Name 1" FROM "t"`, `SELECT "Name 1" FROM "t"`},
+		{"identifier digits", "SELECT t1.a2 FROM t1", "SELECT t1.a2 FROM t1"},
+		{"line comment", "SELECT 1 -- note\nFROM t", "SELECT ? FROM t"},
+		{"nested block comment", "SELECT /* a /* b */ c */ 1", "SELECT ?"},
+		{"whitespace", "SELECT\t*\n  FROM   t", "SELECT * FROM t"},
+		{"integer", "LIMIT 10", "LIMIT ?"},
+		{"decimal", "x = 1.5", "x = ?"},
+		{"leading dot", "x = .5", "x = ?"},
+		{"exponent", "x = 1.5e3", "x = ?"},
+		{"signed exponent", "x = 1e-3", "x = ?"},
+		{"negative", "x = -1.5e3", "x = ?"},
+		{"positive", "x = +2", "x = ?"},
+		{"negative after comma", "VALUES (1, -2)", "VALUES (?)"},
+		{"binary minus", "a - 1", "a - ?"},
+		{"binary minus after parenthesis", "(a)-1", "(a)-?"},
+		{"binary plus after placeholder", "$1 + 2", "? + ?"},
+		{"in list", "WHERE id IN (1, 2, 3)", "WHERE id IN (?)"},
+		{"in list of strings", "WHERE id IN ('a','b')", "WHERE id IN (?)"},
+		{"in list of negatives", "WHERE id IN (-1, -2)", "WHERE id IN (?)"},
+		{"multi-row values", "INSERT INTO t (a, b) VALUES (1, 'x'), (2, 'y')", "INSERT INTO t (a, b) VALUES (?)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Fingerprint(tt.sql); got != tt.want {
+				t.Errorf("Fingerprint(%q) = %q; want %q", tt.sql, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFingerprintCollapsesListLengths(t *testing.T) {
+	want := Fingerprint("SELECT * FROM users WHERE id IN (1)")
+	for _, sql := range []string{
+		"SELECT * FROM users WHERE id IN (1, 2)",
+		"SELECT * FROM users WHERE id IN (1,2,3,4,5)",
+		"SELECT * FROM users WHERE id IN ($1, $2, $3)",
+		"SELECT * FROM users WHERE id IN (-7, 8)",
+	} {
+		if got := Fingerprint(sql); got != want {
+			t.Errorf("Fingerprint(%q) = %q; want %q", sql, got, want)
+		}
+	}
+}
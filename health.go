@@ -0,0 +1,123 @@
+/*
+Package database provides a background health check with automatic reconnection.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+Readiness probes that ping the database on every request add load exactly when the database
+is struggling, and fail slowly when it is unreachable. StartHealthLoop pings the primary at a
+fixed interval in the background and caches the outcome, which Healthy returns without any
+I/O. After HealthFailureThreshold consecutive failed pings, the loop recycles the pooled
+connections with RecycleConnections, so connections left stale by a failover or a network
+partition are replaced by fresh ones once the server is reachable again.
+
+Example usage:
+
+	db.StartHealthLoop(ctx, 5*time.Second)
+
+	http.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+	    if !db.Healthy() {
+	        w.WriteHeader(http.StatusServiceUnavailable)
+	    }
+	})
+*/
+
+package database
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// HealthFailureThreshold is the number of consecutive failed pings after which the health
+// loop recycles the pooled connections.
+var HealthFailureThreshold = 3
+
+// StartHealthLoop starts a background worker pinging the primary every interval, the first
+// time immediately, and caching the result for Healthy. Each ping times out after interval.
+// Failed pings are logged as warnings; after HealthFailureThreshold consecutive failures the
+// pooled connections are recycled, and again after each further HealthFailureThreshold failures.
+//
+// The worker stops when ctx is cancelled or the database is closed, and Healthy then reports
+// false. At most one worker runs at a time; calling StartHealthLoop while one is running does
+// nothing.
+//
+// Parameters:
+//
+//	ctx (context.Context): Context whose cancellation stops the worker.
+//	interval (time.Duration): Time between two pings. Must be positive.
+//
+// Example:
+//
+//	db := database.New(...)
+//	db.StartHealthLoop(ctx, 10*time.Second)
+func (db *PostgreSQL) StartHealthLoop(ctx context.Context, interval time.Duration) {
+	if interval <= 0 || !atomic.CompareAndSwapInt32(&db.healthRunning, 0, 1) {
+		return
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&db.healthRunning, 0)
+		defer atomic.StoreInt32(&db.healthy, 0)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		failures := 0
+		for {
+			if db.checkHealth(ctx, interval) {
+				failures = 0
+			} else if failures++; failures >= HealthFailureThreshold {
+				db.DB.Logger.Warn(ctx, "health check failed %d times in a row, recycling connections", failures)
+				db.RecycleConnections()
+				failures = 0
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-db.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// checkHealth pings the primary within timeout, caches the result and reports whether the
+// ping succeeded.
+func (db *PostgreSQL) checkHealth(ctx context.Context, timeout time.Duration) bool {
+	sqlDB, err := db.DB.DB()
+	if err == nil {
+		pingCtx, cancel := context.WithTimeout(ctx, timeout)
+		err = sqlDB.PingContext(pingCtx)
+		cancel()
+	}
+	if err != nil {
+		if ctx.Err() == nil {
+			db.DB.Logger.Warn(ctx, "health check failed; %s", err.Error())
+		}
+		atomic.StoreInt32(&db.healthy, 0)
+		return false
+	}
+
+	atomic.StoreInt32(&db.healthy, 1)
+	return true
+}
+
+// Healthy reports whether the last ping of the health loop started by StartHealthLoop
+// succeeded. It does no I/O, so it is cheap enough for every readiness probe. It reports
+// false before the first ping succeeded and once the loop has stopped.
+//
+// Example:
+//
+//	db := database.New(...)
+//	if !db.Healthy() {
+//	    fmt.Println("Database unavailable")
+//	}
+func (db *PostgreSQL) Healthy() bool {
+	return atomic.LoadInt32(&db.healthy) == 1
+}
@@ -0,0 +1,269 @@
+/*
+Package database provides a scannable type and query helpers for PostgreSQL hstore columns.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+Hstore maps the keys of an hstore column to their values, with nil for NULL values, and
+implements sql.Scanner and driver.Valuer. A NULL column scans into a nil map; a nil map is
+written as NULL. Keys and values are always quoted when written, so "=>", commas, quotes
+and backslashes are preserved as text.
+
+HstoreGet, HstoreHasKey and HstoreContains build the ->, ? and @> operators. They write the
+operators directly instead of going through a condition string, where gorm would take the ?
+operator for a placeholder, and they keep using a GIN or GiST index on the column.
+
+Example usage:
+
+	type Product struct {
+	    ID    uint
+	    Attrs database.Hstore // hstore
+	}
+
+	color := "red"
+	db.Create(&Product{Attrs: database.Hstore{"color": &color, "size": nil}})
+
+	db.Where(database.HstoreHasKey("attrs", "color")).Find(&products)
+	db.Where(database.HstoreContains("attrs", database.Hstore{"color": &color})).Find(&products)
+	db.Where("? = ?", database.HstoreGet("attrs", "color"), "red").Find(&products)
+
+Notes:
+  - The hstore extension must be installed: CREATE EXTENSION IF NOT EXISTS hstore.
+*/
+
+package database
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm/clause"
+)
+
+// Hstore is a PostgreSQL hstore column. A nil value is a NULL value of its key.
+type Hstore map[string]*string
+
+// GormDataType returns the column type used by AutoMigrate.
+func (Hstore) GormDataType() string {
+	return "hstore"
+}
+
+// Scan implements sql.Scanner.
+func (h *Hstore) Scan(src interface{}) error {
+	var text string
+	switch v := src.(type) {
+	case nil:
+		*h = nil
+		return nil
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	default:
+		return fmt.Errorf("failed to scan hstore; unsupported type %T", src)
+	}
+
+	result, err := parseHstore(text)
+	if err != nil {
+		return fmt.Errorf("failed to scan hstore %q; %s", text, err.Error())
+	}
+
+	*h = result
+	return nil
+}
+
+// Value implements driver.Valuer. Pairs are written in key order, so equal maps produce
+// equal literals.
+func (h Hstore) Value() (driver.Value, error) {
+	if h == nil {
+		return nil, nil
+	}
+
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		value := "NULL"
+		if v := h[k]; v != nil {
+			value = quoteArrayElement(*v)
+		}
+		pairs[i] = quoteArrayElement(k) + "=>" + value
+	}
+	return strings.Join(pairs, ", "), nil
+}
+
+// parseHstore parses an hstore literal such as "a"=>"1", "b"=>NULL.
+func parseHstore(text string) (Hstore, error) {
+	result := make(Hstore)
+
+	p := hstoreParser{text: text}
+	p.skipSpace()
+	for !p.done() {
+		key, quoted, err := p.token()
+		if err != nil {
+			return nil, err
+		}
+		if !quoted && strings.EqualFold(key, "NULL") {
+			return nil, fmt.Errorf("key at offset %d is NULL", p.pos)
+		}
+
+		p.skipSpace()
+		if !strings.HasPrefix(p.text[p.pos:], "=>") {
+			return nil, fmt.Errorf("expected => at offset %d", p.pos)
+		}
+		p.pos += len("=>")
+		p.skipSpace()
+
+		value, quoted, err := p.token()
+		if err != nil {
+			return nil, err
+		}
+		if !quoted && strings.EqualFold(value, "NULL") {
+			result[key] = nil
+		} else {
+			result[key] = &value
+		}
+
+		p.skipSpace()
+		if p.done() {
+			break
+		}
+		if p.text[p.pos] != ',' {
+			return nil, fmt.Errorf("unexpected %q at offset %d", p.text[p.pos], p.pos)
+		}
+		p.pos++
+		p.skipSpace()
+	}
+
+	return result, nil
+}
+
+// hstoreParser reads the tokens of an hstore literal.
+type hstoreParser struct {
+	text string
+	pos  int
+}
+
+// done reports whether the whole literal was read.
+func (p *hstoreParser) done() bool {
+	return p.pos == len(p.text)
+}
+
+// skipSpace skips whitespace.
+func (p *hstoreParser) skipSpace() {
+	for !p.done() && unicode.IsSpace(rune(p.text[p.pos])) {
+		p.pos++
+	}
+}
+
+// token reads a key or value, either double-quoted with backslash escapes or unquoted up to
+// the next whitespace, "=>" or comma, and reports whether it was quoted.
+func (p *hstoreParser) token() (string, bool, error) {
+	if p.done() {
+		return "", false, fmt.Errorf("unexpected end of literal")
+	}
+
+	var b strings.Builder
+	if p.text[p.pos] == '"' {
+		for p.pos++; !p.done() && p.text[p.pos] != '"'; p.pos++ {
+			if p.text[p.pos] == '\\' {
+				p.pos++
+				if p.done() {
+					return "", false, fmt.Errorf("unterminated escape")
+				}
+			}
+			b.WriteByte(p.text[p.pos])
+		}
+		if p.done() {
+			return "", false, fmt.Errorf("unterminated quoted string")
+		}
+		p.pos++ // closing quote
+		return b.String(), true, nil
+	}
+
+	for ; !p.done(); p.pos++ {
+		c := p.text[p.pos]
+		if c == ',' || unicode.IsSpace(rune(c)) || strings.HasPrefix(p.text[p.pos:], "=>") {
+			break
+		}
+		if c == '\\' {
+			p.pos++
+			if p.done() {
+				return "", false, fmt.Errorf("unterminated escape")
+			}
+			c = p.text[p.pos]
+		}
+		b.WriteByte(c)
+	}
+	if b.Len() == 0 {
+		return "", false, fmt.Errorf("expected key or value at offset %d", p.pos)
+	}
+	return b.String(), false, nil
+}
+
+// hstoreOperator is a binary hstore operator applied to a column.
+type hstoreOperator struct {
+	column   string
+	operator string
+	operand  interface{}
+	cast     string // type the operand is cast to, if any
+}
+
+// Build writes the column, the operator and the operand as a bound parameter.
+func (o hstoreOperator) Build(builder clause.Builder) {
+	builder.WriteQuoted(clause.Column{Name: o.column})
+	builder.WriteString(" " + o.operator + " ")
+	if o.cast != "" {
+		builder.WriteString("CAST(")
+		builder.AddVar(builder, o.operand)
+		builder.WriteString(" AS " + o.cast + ")")
+		return
+	}
+	builder.AddVar(builder, o.operand)
+}
+
+// HstoreGet returns the expression column -> key, the value of key in the hstore column, or
+// NULL when the key is missing. column may be table-qualified, e.g. "products.attrs".
+//
+// Example:
+//
+//	db := database.New(...)
+//	err := db.Where("? = ?", database.HstoreGet("attrs", "color"), "red").Find(&products).Error
+func HstoreGet(column, key string) clause.Expression {
+	return hstoreOperator{column: column, operator: "->", operand: key}
+}
+
+// HstoreHasKey returns the condition column ? key, true when the hstore column contains key,
+// even with a NULL value.
+//
+// Example:
+//
+//	db := database.New(...)
+//	err := db.Where(database.HstoreHasKey("attrs", "color")).Find(&products).Error
+func HstoreHasKey(column, key string) clause.Expression {
+	return hstoreOperator{column: column, operator: "?", operand: key}
+}
+
+// HstoreContains returns the condition column @> subset, true when the hstore column contains
+// every pair of subset.
+//
+// Example:
+//
+//	db := database.New(...)
+//	red := "red"
+//	err := db.Where(database.HstoreContains("attrs", database.Hstore{"color": &red})).Find(&products).Error
+func HstoreContains(column string, subset Hstore) clause.Expression {
+	if subset == nil {
+		subset = Hstore{}
+	}
+	return hstoreOperator{column: column, operator: "@>", operand: subset, cast: "hstore"}
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+// strPtr returns a pointer to s.
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestHstoreRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		hstore  Hstore
+		literal interface{}
+	}{
+		{"NULL", nil, nil},
+		{"empty", Hstore{}, ""},
+		{"NULL value", Hstore{"k": nil}, `"k"=>NULL`},
+		{"word NULL as value", Hstore{"k": strPtr("NULL")}, `"k"=>"NULL"`},
+		{"sorted pairs", Hstore{"b": strPtr("2"), "a": strPtr("1")}, `"a"=>"1", "b"=>"2"`},
+		{"arrow", Hstore{"a=>b": strPtr("c=>d")}, `"a=>b"=>"c=>d"`},
+		{"quotes", Hstore{`say "hi"`: strPtr(`"quoted"`)}, `"say \"hi\""=>"\"quoted\""`},
+		{"backslashes", Hstore{`C:\`: strPtr(`\\server`)}, `"C:\\"=>"\\\\server"`},
+		{"separators", Hstore{"a, b": strPtr(" padded "), "": strPtr("")}, `""=>"", "a, b"=>" padded "`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := tt.hstore.Value()
+			if err != nil {
+				t.Fatalf("Value failed; %s", err.Error())
+			}
+			if value != tt.literal {
+				t.Errorf("Value = %#v; want %#v", value, tt.literal)
+			}
+
+			var scanned Hstore
+			if err := scanned.Scan(value); err != nil {
+				t.Fatalf("Scan failed; %s", err.Error())
+			}
+			if !reflect.DeepEqual(scanned, tt.hstore) {
+				t.Errorf("Scan = %v; want %v", scanned, tt.hstore)
+			}
+		})
+	}
+}
+
+func TestHstoreScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     interface{}
+		want    Hstore
+		wantErr bool
+	}{
+		{"server output", []byte(`"a"=>"1", "b"=>NULL`), Hstore{"a": strPtr("1"), "b": nil}, false},
+		{"unquoted", `a=>1,b => NULL`, Hstore{"a": strPtr("1"), "b": nil}, false},
+		{"quoted NULL key", `"NULL"=>"x"`, Hstore{"NULL": strPtr("x")}, false},
+		{"NULL key", `NULL=>"x"`, nil, true},
+		{"missing arrow", `"a" "1"`, nil, true},
+		{"missing value", `"a"=>`, nil, true},
+		{"unterminated quote", `"a"=>"1`, nil, true},
+		{"missing comma", `"a"=>"1" "b"=>"2"`, nil, true},
+		{"unsupported type", 1, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var h Hstore
+			err := h.Scan(tt.src)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Scan error = %v; want error %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(h, tt.want) {
+				t.Errorf("Scan = %v; want %v", h, tt.want)
+			}
+		})
+	}
+}
+
+func TestHstoreOperators(t *testing.T) {
+	db := newDryRunDB(t)
+	red := "red"
+
+	tests := []struct {
+		name     string
+		where    []interface{}
+		wantSQL  string
+		wantVars []interface{}
+	}{
+		{"HstoreHasKey", []interface{}{HstoreHasKey("attrs", "color")}, `SELECT * FROM "test_counters" WHERE "attrs" ? $1`, []interface{}{"color"}},
+		{"HstoreContains", []interface{}{HstoreContains("attrs", Hstore{"color": &red})}, `SELECT * FROM "test_counters" WHERE "attrs" @> CAST($1 AS hstore)`, []interface{}{Hstore{"color": &red}}},
+		{"HstoreGet", []interface{}{"? = ?", HstoreGet("products.attrs", "color"), "red"}, `SELECT * FROM "test_counters" WHERE "products"."attrs" -> $1 = $2`, []interface{}{"color", "red"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rows []testCounter
+			stmt := db.DB.Where(tt.where[0], tt.where[1:]...).Find(&rows).Statement
+
+			if sql := stmt.SQL.String(); sql != tt.wantSQL {
+				t.Errorf("SQL = %q; want %q", sql, tt.wantSQL)
+			}
+			if !reflect.DeepEqual(stmt.Vars, tt.wantVars) {
+				t.Errorf("Vars = %v; want %v", stmt.Vars, tt.wantVars)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+/*
+Package database provides startup checks for required indexes.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+A query that is fast in development can time out in production because an index it relies
+on was never created there, e.g. after a migration was skipped or an index was dropped by
+hand. HasIndex checks for a single index; RequireIndexes checks a whole list at startup, so
+a service missing one of its indexes fails fast at boot instead of scanning tables under
+load.
+
+Example usage:
+
+	err := db.RequireIndexes(ctx, map[string][]string{
+	    "orders":       {"orders_customer_id_idx", "orders_created_at_idx"},
+	    "sales.events": {"events_pkey"},
+	})
+	if err != nil {
+	    log.Fatal(err) // index missing; orders.orders_created_at_idx
+	}
+*/
+
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrIndexMissing is returned by RequireIndexes when a required index does not exist.
+var ErrIndexMissing = errors.New("index missing")
+
+// HasIndex reports whether table has an index named index.
+//
+// Parameters:
+//
+//	ctx (context.Context): Context of the query. An ambient transaction from WithTransaction is joined.
+//	table (string): Table of the index, optionally schema-qualified. It is quoted.
+//	index (string): Name of the index, as listed in pg_indexes.
+//
+// Returns:
+//
+//	bool: True if the index exists on table.
+//	error: An error if the table does not exist or the query fails.
+//
+// Example:
+//
+//	db := database.New(...)
+//	ok, err := db.HasIndex(ctx, "users", "users_email_key")
+//	if err != nil {
+//	    fmt.Println("Error checking index:", err)
+//	}
+func (db *PostgreSQL) HasIndex(ctx context.Context, table, index string) (bool, error) {
+	var exists bool
+	err := db.Conn(ctx).Raw(`SELECT EXISTS (SELECT 1 FROM pg_index i JOIN pg_class c ON c.oid = i.indexrelid
+		WHERE i.indrelid = ?::regclass AND c.relname = ?)`, quoteQualifiedName(table), index).Scan(&exists).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to check index %s on %s; %s", index, table, err.Error())
+	}
+
+	return exists, nil
+}
+
+// RequireIndexes checks that every table of indexes has each of the listed indexes, and
+// reports all missing indexes at once. It is meant to run at startup.
+//
+// Parameters:
+//
+//	ctx (context.Context): Context of the queries.
+//	indexes (map[string][]string): Index names keyed by table, optionally schema-qualified.
+//
+// Returns:
+//
+//	error: An error wrapping ErrIndexMissing that lists the missing indexes as table.index, or
+//	  an error if a table does not exist or a query fails.
+//
+// Example:
+//
+//	db := database.New(...)
+//	if err := db.RequireIndexes(ctx, map[string][]string{"users": {"users_email_key"}}); err != nil {
+//	    log.Fatal(err)
+//	}
+func (db *PostgreSQL) RequireIndexes(ctx context.Context, indexes map[string][]string) error {
+	tables := make([]string, 0, len(indexes))
+	for table := range indexes {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+
+	var missing []string
+	for _, table := range tables {
+		for _, index := range indexes[table] {
+			ok, err := db.HasIndex(ctx, table, index)
+			if err != nil {
+				return fmt.Errorf("failed to require indexes; %s", err.Error())
+			}
+			if !ok {
+				missing = append(missing, table+"."+index)
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%w; %s", ErrIndexMissing, strings.Join(missing, ", "))
+	}
+	return nil
+}
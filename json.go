@@ -0,0 +1,64 @@
+/*
+Package database provides JSON shaping of query results for PostgreSQL connections.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+QueryJSON wraps a SELECT statement in json_agg, so the rows are encoded as a JSON array by
+the server and returned as a single document. Nested responses can be shaped in SQL with
+json_build_object and correlated json_agg subqueries, and written to a client without being
+decoded into Go values first.
+
+Example usage:
+
+	doc, err := db.QueryJSON(ctx, `
+	    SELECT o.id, o.total,
+	           (SELECT json_agg(json_build_object('sku', i.sku, 'qty', i.qty))
+	              FROM order_items i WHERE i.order_id = o.id) AS items
+	      FROM orders o WHERE o.customer_id = ?`, customerID)
+	// [{"id":1,"total":42.5,"items":[{"sku":"A-1","qty":2}]}]
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(doc)
+*/
+
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// QueryJSON runs query and returns its rows as a JSON array of objects, one per row, keyed by
+// column name. A query returning no rows yields an empty array.
+//
+// Parameters:
+//
+//	ctx (context.Context): Context of the query. An ambient transaction from WithTransaction is joined.
+//	query (string): SELECT statement, with ? placeholders for args.
+//	args (...interface{}): Arguments of the query.
+//
+// Returns:
+//
+//	json.RawMessage: The rows encoded as a JSON array.
+//	error: An error if the query fails.
+//
+// Example:
+//
+//	db := database.New(...)
+//	doc, err := db.QueryJSON(ctx, "SELECT id, name FROM users WHERE active = ?", true)
+//	if err != nil {
+//	    fmt.Println("Error querying users:", err)
+//	}
+func (db *PostgreSQL) QueryJSON(ctx context.Context, query string, args ...interface{}) (json.RawMessage, error) {
+	var doc []byte
+	row := db.Conn(ctx).Raw(fmt.Sprintf("SELECT COALESCE(json_agg(t), '[]'::json) FROM (%s) t", query), args...).Row()
+	if err := row.Scan(&doc); err != nil {
+		return nil, fmt.Errorf("failed to query json; %s", err.Error())
+	}
+
+	return json.RawMessage(doc), nil
+}
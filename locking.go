@@ -0,0 +1,197 @@
+/*
+Package database provides row locking helpers for PostgreSQL connections.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+ForUpdate returns a session whose SELECT statements lock the rows they return with FOR
+UPDATE, so a read-modify-write sequence inside a transaction is not interleaved with other
+writers. The locks are held until the transaction ends; outside of a transaction they are
+released as soon as the statement completes.
+
+DequeueForUpdate claims one row of a job queue table with FOR UPDATE SKIP LOCKED, so
+concurrent workers each receive a different row instead of blocking on one another. It must
+run inside WithTransaction: the claim lasts until that transaction commits or rolls back,
+which is also when the worker's changes to the row become visible.
+
+WithLockTimeout runs a unit of work with lock_timeout set, so a statement waiting on a lock
+fails fast with a lock_not_available error instead of blocking, e.g. to answer "try again"
+rather than hang a request.
+
+Helpers such as FindByTuples and CreateIgnoringConflicts accept additional clause.Expression
+values for the same purpose, e.g. clause.Locking{Strength: "UPDATE", Options: "NOWAIT"}.
+
+Example usage:
+
+	err := db.WithTransaction(ctx, func(ctx context.Context) error {
+	    var job Job
+	    if err := db.DequeueForUpdate(ctx, &job, "status = ?", "pending"); err != nil {
+	        return err // gorm.ErrRecordNotFound when no pending job is available
+	    }
+	    return db.Conn(ctx).Model(&job).Update("status", process(job)).Error
+	})
+
+	err = db.ForUpdate().Transaction(func(tx *gorm.DB) error {
+	    var account Account
+	    if err := tx.First(&account, id).Error; err != nil { // SELECT ... FOR UPDATE
+	        return err
+	    }
+	    account.Balance -= amount
+	    return tx.Save(&account).Error
+	})
+
+Inside WithTransaction, lock through the ambient transaction instead:
+
+	db.Conn(ctx).Clauses(clause.Locking{Strength: "UPDATE"}).First(&account, id)
+*/
+
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrNoTransaction is returned by helpers that must run inside WithTransaction when ctx carries no transaction.
+var ErrNoTransaction = errors.New("no transaction in context")
+
+// ForUpdate returns a session whose SELECT statements end with FOR UPDATE. The session can
+// be reused; every statement started from it gets the locking clause.
+//
+// Example:
+//
+//	db := database.New(...)
+//	var job Job
+//	err := db.ForUpdate().Transaction(func(tx *gorm.DB) error {
+//	    return tx.First(&job, id).Error
+//	})
+func (db *PostgreSQL) ForUpdate() *gorm.DB {
+	return db.DB.Clauses(clause.Locking{Strength: "UPDATE"}).Session(&gorm.Session{})
+}
+
+// DequeueForUpdate locks and loads into dest one row matching where that is not locked by
+// another transaction. Rows locked by concurrent workers are skipped rather than waited for.
+// The row stays locked until the ambient transaction ends.
+//
+// Parameters:
+//
+//	ctx (context.Context): Context carrying the transaction started by WithTransaction.
+//	dest (interface{}): Pointer to the model receiving the row.
+//	where (string): Condition selecting eligible rows, e.g. "status = ?".
+//	args (...interface{}): Arguments of the condition.
+//
+// Returns:
+//
+//	error: gorm.ErrRecordNotFound when no unlocked row matches, an error wrapping
+//	ErrNoTransaction when ctx carries no transaction, or an error if the query fails.
+//
+// Example:
+//
+//	db := database.New(...)
+//	err := db.WithTransaction(ctx, func(ctx context.Context) error {
+//	    var job Job
+//	    if err := db.DequeueForUpdate(ctx, &job, "status = ? AND run_at <= now()", "pending"); err != nil {
+//	        return err
+//	    }
+//	    return db.Conn(ctx).Model(&job).Update("status", "done").Error
+//	})
+func (db *PostgreSQL) DequeueForUpdate(ctx context.Context, dest interface{}, where string, args ...interface{}) error {
+	// Outside of a transaction the lock would be released as soon as the row is returned.
+	if _, ok := transactionFromContext(ctx); !ok {
+		return fmt.Errorf("%w; DequeueForUpdate must run inside WithTransaction", ErrNoTransaction)
+	}
+
+	err := db.Conn(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where(where, args...).
+		Take(dest).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to dequeue; %s", err.Error())
+	}
+
+	return nil
+}
+
+// WithLockTimeout runs fn in a transaction whose statements wait at most d for a lock. A
+// statement that cannot acquire its lock in time fails with SQLSTATE 55P03, which Normalize
+// maps to ErrLockTimeout. d is rounded down to milliseconds, with a minimum of 1ms.
+//
+// Inside a transaction stored in ctx by WithTransaction, fn runs in a savepoint of that
+// transaction instead: if fn fails, e.g. on a lock timeout, only its work is rolled back and
+// the ambient transaction stays usable. The ambient transaction's lock_timeout is restored
+// when fn succeeds.
+//
+// Parameters:
+//
+//	ctx (context.Context): Context bound to the session passed to fn.
+//	d (time.Duration): Maximum time a statement waits for a lock. Must be positive.
+//	fn (func(tx *gorm.DB) error): Issues the statements on tx.
+//
+// Returns:
+//
+//	error: The error returned by fn, or an error if the lock timeout cannot be set.
+//
+// Example:
+//
+//	db := database.New(...)
+//	err := db.WithLockTimeout(ctx, 500*time.Millisecond, func(tx *gorm.DB) error {
+//	    return tx.Model(&account).Update("balance", gorm.Expr("balance - ?", amount)).Error
+//	})
+//	if errors.Is(database.Normalize(err), database.ErrLockTimeout) {
+//	    fmt.Println("Account is busy, try again")
+//	}
+func (db *PostgreSQL) WithLockTimeout(ctx context.Context, d time.Duration, fn func(tx *gorm.DB) error) error {
+	if d <= 0 {
+		return fmt.Errorf("failed to set lock timeout; timeout must be positive, got %s", d)
+	}
+
+	timeout := d.Milliseconds()
+	if timeout < 1 {
+		timeout = 1
+	}
+	run := func(tx *gorm.DB) error {
+		if err := setLockTimeout(tx, strconv.FormatInt(timeout, 10)+"ms"); err != nil {
+			return err
+		}
+		return fn(tx)
+	}
+
+	outer, ok := transactionFromContext(ctx)
+	if !ok {
+		return db.DB.WithContext(ctx).Transaction(run)
+	}
+
+	conn := outer.WithContext(ctx)
+	var previous string
+	if err := conn.Raw("SELECT current_setting('lock_timeout')").Scan(&previous).Error; err != nil {
+		return fmt.Errorf("failed to read lock timeout; %s", err.Error())
+	}
+
+	// Rolling back to the savepoint reverts the setting; releasing it does not.
+	return conn.Transaction(func(tx *gorm.DB) error {
+		if err := run(tx); err != nil {
+			return err
+		}
+		return setLockTimeout(tx, previous)
+	})
+}
+
+// setLockTimeout sets lock_timeout until the end of the transaction of tx.
+func setLockTimeout(tx *gorm.DB, value string) error {
+	// is_local = true reverts the setting when the transaction ends.
+	if err := tx.Exec("SELECT set_config('lock_timeout', ?, true)", value).Error; err != nil {
+		return fmt.Errorf("failed to set lock timeout; %s", err.Error())
+	}
+	return nil
+}
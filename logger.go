@@ -31,9 +31,19 @@ package database
 
 import (
 	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
@@ -45,13 +55,136 @@ type dbLogger struct {
 	// Format strings for different log levels
 	infoStr, warnStr, errStr            string
 	traceStr, traceWarnStr, traceErrStr string
+
+	// bindParams captures bound arguments so they can be logged apart from the SQL
+	bindParams *paramsCapture
+
+	// txSummary logs one summary line per transaction started by WithTransaction
+	txSummary bool
+
+	// slowFingerprint logs slow queries by their Fingerprint instead of the full statement
+	slowFingerprint bool
+
+	// errorsOnly traces failing statements only, whatever the log level
+	errorsOnly bool
+
+	// skipCancelled does not trace successful statements of cancelled contexts
+	skipCancelled bool
+
+	// slowCaller includes the calling source location in slow query lines; callerSkip skips
+	// that many further frames, e.g. of the application's own repository helpers
+	slowCaller bool
+	callerSkip int
+
+	// recent keeps the last traced statements for RecentQueries; nil disables it
+	recent *queryHistory
+}
+
+// LoggerOption configures optional behavior of the database logger.
+type LoggerOption func(*dbLogger)
+
+// paramsCapture holds the bound arguments of the statement currently being traced.
+type paramsCapture struct {
+	mu sync.Mutex // serializes the statements being traced
+
+	slotMu sync.Mutex
+	slot   *[]interface{} // receives the arguments of the traced statement; nil outside captureSQL
+}
+
+// setSlot sets the slot receiving the arguments passed to ParamsFilter.
+func (c *paramsCapture) setSlot(slot *[]interface{}) {
+	c.slotMu.Lock()
+	c.slot = slot
+	c.slotMu.Unlock()
+}
+
+// capture stores params in the current slot and reports whether a statement is being traced.
+func (c *paramsCapture) capture(params []interface{}) bool {
+	c.slotMu.Lock()
+	defer c.slotMu.Unlock()
+
+	if c.slot == nil {
+		return false
+	}
+	*c.slot = params
+	return true
+}
+
+// WithBindParams logs statements with their placeholders intact and the bound arguments as a
+// separate JSON array field, e.g. "SELECT * FROM users WHERE id = $1 [args:[42]]".
+// Arguments are omitted when logger.Config.ParameterizedQueries is enabled.
+//
+// Tracing is serialized while this option is enabled; it is meant for debugging.
+func WithBindParams() LoggerOption {
+	return func(l *dbLogger) {
+		l.bindParams = &paramsCapture{}
+	}
+}
+
+// WithRecordNotFoundErrors logs "record not found" errors, e.g. from First, as errors.
+// SetLogger ignores them by default, treating them as expected control flow.
+func WithRecordNotFoundErrors() LoggerOption {
+	return func(l *dbLogger) {
+		l.IgnoreRecordNotFoundError = false
+	}
+}
+
+// WithTransactionSummary logs one info line per transaction started by WithTransaction, with
+// its outcome, total duration and number of statements, e.g.
+// "[info] tx checkout committed in 850.211ms, 12 statements". Summaries are logged at every
+// level except Silent; individual statements are still traced according to the log level.
+func WithTransactionSummary() LoggerOption {
+	return func(l *dbLogger) {
+		l.txSummary = true
+	}
+}
+
+// WithSlowQueryFingerprint logs slow queries by their Fingerprint, with literals and bound
+// arguments replaced by ?, so slow query shapes can be grouped in log search. The duration and
+// row count are still logged. Other trace lines are unchanged.
+func WithSlowQueryFingerprint() LoggerOption {
+	return func(l *dbLogger) {
+		l.slowFingerprint = true
+	}
+}
+
+// WithSlowQueryCaller includes the file:line that issued a slow query in its log line, e.g.
+// "orders/repository.go:42 SLOW SQL >= 200ms". Frames of gorm and of this package are skipped,
+// as are skip further frames, e.g. of shared data access helpers in the application.
+func WithSlowQueryCaller(skip int) LoggerOption {
+	return func(l *dbLogger) {
+		l.slowCaller = true
+		l.callerSkip = skip
+	}
+}
+
+// LogErrorsOnly traces failing statements, with their full SQL and arguments, and nothing
+// else: successful statements are not logged, even when slow or at Info level. Failing
+// statements are logged at every level except Silent. Combine with WithBindParams to log the
+// arguments apart from the SQL.
+func LogErrorsOnly() LoggerOption {
+	return func(l *dbLogger) {
+		l.errorsOnly = true
+	}
+}
+
+// SkipCancelledQueries does not trace successful statements whose context is already
+// cancelled or past its deadline, e.g. the trailing queries of an aborted request, reducing
+// noise in chatty debug sessions. Failing statements, including those failing because of the
+// cancellation, are still logged, so cancellations are not hidden.
+func SkipCancelledQueries() LoggerOption {
+	return func(l *dbLogger) {
+		l.skipCancelled = true
+	}
 }
 
 // NewLogger creates a new instance of the custom database logger with the given writer and configuration.
-func NewLogger(writer logger.Writer, config logger.Config) *dbLogger {
+func NewLogger(writer logger.Writer, config logger.Config, opts ...LoggerOption) *dbLogger {
+	var l *dbLogger
+
 	// Customize log message format based on the configuration's Colorful setting
 	if config.Colorful {
-		return &dbLogger{
+		l = &dbLogger{
 			Writer:       writer,
 			Config:       config,
 			infoStr:      "\033[0m\033[32m[info] %s\033[0m",
@@ -62,7 +195,7 @@ func NewLogger(writer logger.Writer, config logger.Config) *dbLogger {
 			traceErrStr:  "\033[35;1m%s \033[0m\033[33m[%.3fms] \033[34;1m[rows:%v]\033[0m %s",
 		}
 	} else {
-		return &dbLogger{
+		l = &dbLogger{
 			Writer:       writer,
 			Config:       config,
 			infoStr:      "[info] %s",
@@ -73,6 +206,12 @@ func NewLogger(writer logger.Writer, config logger.Config) *dbLogger {
 			traceErrStr:  "%s [%.3fms] [rows:%v] %s",
 		}
 	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return l
 }
 
 // LogMode sets the logger's log level and returns a new logger instance with the updated settings.
@@ -105,23 +244,72 @@ func (l *dbLogger) Error(ctx context.Context, msg string, data ...interface{}) {
 
 // Trace logs detailed information about a database operation, including its duration and parameters.
 func (l *dbLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if l.recent != nil {
+		// Recorded at every log level, with the error as returned to the caller.
+		sql, rows := l.traceSQL(fc)
+		l.recent.add(QueryRecord{Time: begin, SQL: sql, Rows: rows, Duration: time.Since(begin), Err: err})
+	}
+
 	if l.LogLevel <= logger.Silent {
 		return
 	}
 
+	// An ignored "record not found" is traced like a successful query.
+	if err != nil && l.IgnoreRecordNotFoundError && errors.Is(err, logger.ErrRecordNotFound) {
+		err = nil
+	}
+
+	if l.skipCancelled && err == nil && ctx != nil && ctx.Err() != nil {
+		return
+	}
+
+	if l.errorsOnly {
+		if err != nil {
+			sql, rows := l.traceSQL(fc)
+			l.Printf(l.traceErrStr, err, float64(time.Since(begin).Nanoseconds())/1e6, formatRows(rows), sql)
+		}
+		return
+	}
+
+	// A successful query below Info level is only logged when it is slow; skip the clock
+	// read entirely when slow-query logging is off so the common path stays allocation-free.
+	if err == nil && l.LogLevel < logger.Info && (l.SlowThreshold == 0 || l.LogLevel < logger.Warn) {
+		return
+	}
+
 	elapsed := time.Since(begin)
 	switch {
 	case err != nil && l.LogLevel >= logger.Error:
-		sql, rows := fc()
-		l.Printf(l.traceErrStr, err, float64(elapsed.Nanoseconds())/1e6, rows, sql)
+		sql, rows := l.traceSQL(fc)
+		l.Printf(l.traceErrStr, err, float64(elapsed.Nanoseconds())/1e6, formatRows(rows), sql)
 	case elapsed > l.SlowThreshold && l.SlowThreshold != 0 && l.LogLevel >= logger.Warn:
-		sql, rows := fc()
+		var sql string
+		var rows int64
+		if l.slowFingerprint {
+			// Bound arguments are dropped by the fingerprint, so they are not logged.
+			sql, rows, _ = l.captureSQL(fc)
+			sql = Fingerprint(sql)
+		} else {
+			sql, rows = l.traceSQL(fc)
+		}
 		slowLog := fmt.Sprintf("SLOW SQL >= %v", l.SlowThreshold)
-		l.Printf(l.traceWarnStr, slowLog, float64(elapsed.Nanoseconds())/1e6, rows, sql)
+		if l.slowCaller {
+			slowLog = callerLocation(l.callerSkip) + " " + slowLog
+		}
+		l.Printf(l.traceWarnStr, slowLog, float64(elapsed.Nanoseconds())/1e6, formatRows(rows), sql)
 	case l.LogLevel == logger.Info:
-		sql, rows := fc()
-		l.Printf(l.traceStr, float64(elapsed.Nanoseconds())/1e6, rows, sql)
+		sql, rows := l.traceSQL(fc)
+		l.Printf(l.traceStr, float64(elapsed.Nanoseconds())/1e6, formatRows(rows), sql)
+	}
+}
+
+// formatRows returns the row count for a trace line, or "-" when the count is unknown, which
+// gorm reports as -1, e.g. for DDL statements.
+func formatRows(rows int64) interface{} {
+	if rows == -1 {
+		return "-"
 	}
+	return rows
 }
 
 // ParamsFilter filters sensitive parameters from SQL statements if ParameterizedQueries is enabled.
@@ -129,5 +317,129 @@ func (l *dbLogger) ParamsFilter(ctx context.Context, sql string, params ...inter
 	if l.Config.ParameterizedQueries {
 		return sql, nil
 	}
+	if l.bindParams != nil && l.bindParams.capture(params) {
+		// Keep the placeholders in the SQL; traceSQL logs the arguments separately.
+		return sql, nil
+	}
 	return sql, params
 }
+
+// traceSQL invokes fc and returns the traced SQL and row count. With bind parameter logging
+// enabled, the arguments captured by ParamsFilter are appended as a JSON array field.
+func (l *dbLogger) traceSQL(fc func() (string, int64)) (string, int64) {
+	sql, rows, params := l.captureSQL(fc)
+	if l.bindParams == nil || l.Config.ParameterizedQueries {
+		return sql, rows
+	}
+	return sql + " [args:" + formatBindParams(params) + "]", rows
+}
+
+// captureSQL invokes fc and returns the traced SQL and row count, and with bind parameter
+// logging enabled the arguments ParamsFilter received meanwhile. Every call of fc goes through
+// captureSQL, so that only one statement is captured at a time.
+func (l *dbLogger) captureSQL(fc func() (string, int64)) (string, int64, []interface{}) {
+	if l.bindParams == nil {
+		sql, rows := fc()
+		return sql, rows, nil
+	}
+
+	l.bindParams.mu.Lock()
+	defer l.bindParams.mu.Unlock()
+
+	var params []interface{}
+	l.bindParams.setSlot(&params)
+	sql, rows := fc()
+	l.bindParams.setSlot(nil)
+	return sql, rows, params
+}
+
+// formatBindParams encodes params as a JSON array, resolving driver.Valuer arguments first.
+func formatBindParams(params []interface{}) string {
+	values := make([]interface{}, len(params))
+	for i, p := range params {
+		if valuer, ok := p.(driver.Valuer); ok {
+			if v, err := valuer.Value(); err == nil {
+				p = v
+			}
+		}
+		values[i] = p
+	}
+
+	b, err := json.Marshal(values)
+	if err != nil {
+		return fmt.Sprintf("%q", fmt.Sprint(values...))
+	}
+	return string(b)
+}
+
+// traceTransaction logs the summary of a transaction started at begin that ran statements
+// statements and ended with err.
+func (l *dbLogger) traceTransaction(name string, begin time.Time, statements int64, err error) {
+	if !l.txSummary || l.LogLevel <= logger.Silent {
+		return
+	}
+
+	tx := "tx"
+	if name != "" {
+		tx += " " + name
+	}
+	outcome := "committed"
+	if err != nil {
+		outcome = "rolled back"
+	}
+
+	elapsed := time.Since(begin)
+	l.Printf(l.infoStr, fmt.Sprintf("%s %s in %.3fms, %d statements", tx, outcome, float64(elapsed.Nanoseconds())/1e6, statements))
+}
+
+// statementCounter counts the statements traced through it before passing them on.
+type statementCounter struct {
+	logger.Interface
+	statements *int64
+}
+
+// LogMode keeps counting statements on sessions that change the log level, e.g. tx.Debug().
+func (c statementCounter) LogMode(level logger.LogLevel) logger.Interface {
+	return statementCounter{Interface: c.Interface.LogMode(level), statements: c.statements}
+}
+
+// Trace counts the statement and traces it with the wrapped logger.
+func (c statementCounter) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	atomic.AddInt64(c.statements, 1)
+	c.Interface.Trace(ctx, begin, fc, err)
+}
+
+// ParamsFilter forwards to the wrapped logger, which gorm would otherwise not see behind the wrapper.
+func (c statementCounter) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	if filter, ok := c.Interface.(gorm.ParamsFilter); ok {
+		return filter.ParamsFilter(ctx, sql, params...)
+	}
+	return sql, params
+}
+
+// packageDir is the source directory of this package, whose frames callerLocation skips.
+var packageDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Dir(file) + "/"
+}()
+
+// callerLocation returns the file:line of the first frame outside of gorm and this package,
+// after skipping skip further frames.
+func callerLocation(skip int) string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+	for {
+		frame, more := frames.Next()
+		library := strings.Contains(frame.File, "gorm.io/") ||
+			(strings.HasPrefix(frame.File, packageDir) && !strings.Contains(frame.File[len(packageDir):], "/"))
+		if !library && frame.File != "" {
+			if skip == 0 {
+				return frame.File + ":" + strconv.Itoa(frame.Line)
+			}
+			skip--
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm/logger"
+)
+
+// lineWriter collects the lines printed by a logger.
+type lineWriter struct {
+	mu    sync.Mutex
+	lines []string
+}
+
+// Printf implements logger.Writer.
+func (w *lineWriter) Printf(format string, args ...interface{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.lines = append(w.lines, fmt.Sprintf(format, args...))
+}
+
+// explainTrace returns a trace callback that filters its arguments through l and inlines the
+// remaining ones, as gorm does.
+func explainTrace(ctx context.Context, l *dbLogger, sql string, args ...interface{}) func() (string, int64) {
+	return func() (string, int64) {
+		sql, vars := l.ParamsFilter(ctx, sql, args...)
+		for i, v := range vars {
+			sql = strings.Replace(sql, fmt.Sprintf("$%d", i+1), fmt.Sprint(v), 1)
+		}
+		return sql, 1
+	}
+}
+
+func TestTraceCapturesParamsPerStatement(t *testing.T) {
+	w := &lineWriter{}
+	l := NewLogger(w, logger.Config{LogLevel: logger.Info, SlowThreshold: time.Minute},
+		WithBindParams(), WithSlowQueryFingerprint())
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			begin := time.Now()
+			if i%2 == 1 {
+				begin = begin.Add(-time.Hour) // slow, traced by its fingerprint
+			}
+			l.Trace(ctx, begin, explainTrace(ctx, l, fmt.Sprintf("SELECT %d WHERE id = $1", i), i), nil)
+		}(i)
+	}
+	wg.Wait()
+
+	if len(w.lines) != 200 {
+		t.Fatalf("logged %d lines; want 200", len(w.lines))
+	}
+	for _, line := range w.lines {
+		if strings.Contains(line, "SLOW SQL") {
+			if !strings.HasSuffix(line, "SELECT ? WHERE id = ?") || strings.Contains(line, "args:") {
+				t.Errorf("slow line %q; want the fingerprint without arguments", line)
+			}
+			continue
+		}
+		var n, arg int
+		if _, err := fmt.Sscanf(line[strings.Index(line, "SELECT"):], "SELECT %d WHERE id = $1 [args:[%d]]", &n, &arg); err != nil || n != arg {
+			t.Errorf("line %q; want the statement's own argument", line)
+		}
+	}
+}
+
+func TestTraceNothingToLogDoesNotAllocate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config logger.Config
+	}{
+		{"silent", logger.Config{LogLevel: logger.Silent, SlowThreshold: time.Second}},
+		{"success below info", logger.Config{LogLevel: logger.Error, SlowThreshold: time.Second}},
+		{"success without slow threshold", logger.Config{LogLevel: logger.Warn}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &lineWriter{}
+			l := NewLogger(w, tt.config)
+			ctx := context.Background()
+			begin := time.Now()
+			fc := func() (string, int64) { return "SELECT 1", 1 }
+
+			if allocs := testing.AllocsPerRun(100, func() { l.Trace(ctx, begin, fc, nil) }); allocs != 0 {
+				t.Errorf("Trace allocated %v times per call; want 0", allocs)
+			}
+			if len(w.lines) != 0 {
+				t.Errorf("logged %q; want nothing", w.lines)
+			}
+		})
+	}
+}
+
+func BenchmarkTraceSilent(b *testing.B) {
+	l := NewLogger(&lineWriter{}, logger.Config{LogLevel: logger.Silent, SlowThreshold: time.Second})
+	ctx := context.Background()
+	begin := time.Now()
+	fc := func() (string, int64) { return "SELECT 1", 1 }
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Trace(ctx, begin, fc, nil)
+	}
+}
@@ -0,0 +1,95 @@
+/*
+Package database provides a log writer that surfaces its own write failures.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+logger.Writer.Printf returns nothing, so when the destination of the database logger fails,
+e.g. because the log volume is full, log lines vanish silently. A writer created with
+NewLogWriter checks every write and reports failures, at most once per
+LogWriteErrorInterval, together with the number of lines lost since the last report.
+
+Example usage:
+
+	f, _ := os.OpenFile("/var/log/app/db.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+
+	// Failures are reported to stderr, at most once a minute.
+	db.SetLogger(database.NewLogWriter(log.New(f, "", log.LstdFlags), nil))
+*/
+
+package database
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"gorm.io/gorm/logger"
+)
+
+// LogWriteErrorInterval is the minimum time between two reports of failing log writes.
+var LogWriteErrorInterval = time.Minute
+
+// logWriter is a logger.Writer reporting failed writes of its underlying logger.
+type logWriter struct {
+	*log.Logger
+	onError func(err error)
+
+	mu       sync.Mutex
+	reported time.Time // time of the last report
+	dropped  int       // lines lost since the last report
+}
+
+// NewLogWriter returns a logger.Writer for SetLogger that writes through l and reports write
+// failures to onError, at most once per LogWriteErrorInterval. The reported error includes the
+// number of lines lost since the previous report. A nil onError prints reports to os.Stderr.
+//
+// Parameters:
+//
+//	l (*log.Logger): Logger writing to the destination, with its own prefix and flags.
+//	onError (func(err error)): Called with throttled write failures. May be nil.
+//
+// Returns:
+//
+//	logger.Writer: Writer to pass to SetLogger.
+//
+// Example:
+//
+//	db := database.New(...)
+//	db.SetLogger(database.NewLogWriter(log.New(f, "", log.LstdFlags), func(err error) {
+//	    alerts.Notify("database log writes failing", err)
+//	}))
+func NewLogWriter(l *log.Logger, onError func(err error)) logger.Writer {
+	if onError == nil {
+		onError = func(err error) {
+			fmt.Fprintln(os.Stderr, err.Error())
+		}
+	}
+	return &logWriter{Logger: l, onError: onError}
+}
+
+// Printf writes a log line, reporting the failure if the write fails.
+func (w *logWriter) Printf(format string, args ...interface{}) {
+	err := w.Output(2, fmt.Sprintf(format, args...))
+	if err == nil {
+		return
+	}
+
+	w.mu.Lock()
+	w.dropped++
+	now := time.Now()
+	if now.Sub(w.reported) < LogWriteErrorInterval {
+		w.mu.Unlock()
+		return
+	}
+	dropped := w.dropped
+	w.dropped = 0
+	w.reported = now
+	w.mu.Unlock()
+
+	w.onError(fmt.Errorf("failed to write database log; lines lost since last report: %d; %s", dropped, err.Error()))
+}
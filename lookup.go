@@ -0,0 +1,177 @@
+/*
+Package database provides batch lookup helpers for PostgreSQL connections.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+FindByTuples fetches rows by composite keys, e.g. the (user_id, group_id) pairs of a join
+table, with a row-value IN list. Large lookups are split into batches that stay under
+PostgreSQL's limit of 65535 bind parameters per statement.
+
+Example usage:
+
+	var memberships []Membership
+	err := db.FindByTuples(ctx, &memberships, []string{"user_id", "group_id"}, [][]interface{}{
+	    {1, 10},
+	    {2, 20},
+	})
+	// SELECT * FROM "memberships" WHERE ("user_id", "group_id") IN (($1,$2),($3,$4))
+*/
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm/clause"
+)
+
+// maxBindParameters is the maximum number of bind parameters PostgreSQL accepts per statement.
+const maxBindParameters = 65535
+
+// FindByTuples finds the rows whose columns match any of the given tuples and stores them in
+// dest, which must be a pointer to a slice of models. Lookups needing more than 65535 bind
+// parameters are run in several statements. No query is run when tuples is empty.
+//
+// Parameters:
+//
+//	ctx (context.Context): Context of the lookup. An ambient transaction from WithTransaction is joined.
+//	dest (interface{}): Pointer to a slice receiving the rows.
+//	columns ([]string): Columns forming the composite key.
+//	tuples ([][]interface{}): Key values, each holding one value per column.
+//	clauses (...clause.Expression): Additional clauses applied to every query, e.g. clause.Locking{Strength: "UPDATE"}.
+//
+// Returns:
+//
+//	error: An error if the arguments are invalid or a query fails.
+//
+// Example:
+//
+//	db := database.New(...)
+//	var rows []Membership
+//	err := db.FindByTuples(ctx, &rows, []string{"user_id", "group_id"}, [][]interface{}{{1, 10}, {2, 20}})
+//	if err != nil {
+//	    fmt.Println("Error finding memberships:", err)
+//	}
+func (db *PostgreSQL) FindByTuples(ctx context.Context, dest interface{}, columns []string, tuples [][]interface{}, clauses ...clause.Expression) error {
+	if len(columns) == 0 {
+		return fmt.Errorf("failed to find by tuples; no columns given")
+	}
+
+	destValue := reflect.ValueOf(dest)
+	if destValue.Kind() != reflect.Ptr || destValue.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("failed to find by tuples; dest must be a pointer to a slice, got %T", dest)
+	}
+	sliceType := destValue.Elem().Type()
+
+	for i, tuple := range tuples {
+		if len(tuple) != len(columns) {
+			return fmt.Errorf("failed to find by tuples; tuple %d has %d values, want %d", i, len(tuple), len(columns))
+		}
+	}
+
+	result := reflect.MakeSlice(sliceType, 0, len(tuples))
+	if len(tuples) == 0 {
+		destValue.Elem().Set(result)
+		return nil
+	}
+
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = db.DB.Statement.Quote(column)
+	}
+	placeholder := "(" + strings.TrimSuffix(strings.Repeat("?,", len(columns)), ",") + ")"
+
+	batchSize := maxBindParameters / len(columns)
+	for start := 0; start < len(tuples); start += batchSize {
+		end := start + batchSize
+		if end > len(tuples) {
+			end = len(tuples)
+		}
+		batch := tuples[start:end]
+
+		placeholders := make([]string, len(batch))
+		args := make([]interface{}, 0, len(batch)*len(columns))
+		for i, tuple := range batch {
+			placeholders[i] = placeholder
+			args = append(args, tuple...)
+		}
+
+		rows := reflect.New(sliceType)
+		query := fmt.Sprintf("(%s) IN (%s)", strings.Join(quoted, ", "), strings.Join(placeholders, ","))
+		if err := db.Conn(ctx).Clauses(clauses...).Where(query, args...).Find(rows.Interface()).Error; err != nil {
+			return fmt.Errorf("failed to find by tuples; %s", err.Error())
+		}
+		result = reflect.AppendSlice(result, rows.Elem())
+	}
+
+	destValue.Elem().Set(result)
+	return nil
+}
+
+// FindMap finds the rows of V's table matching conds and returns them keyed by keyFn. When
+// several rows share a key, the last one read wins. When conds is a single "column IN ?"
+// condition bound to an empty slice, an empty map is returned without running a query. In
+// other conditions an empty slice bound to "IN ?" is sent as IN (NULL), which is valid SQL
+// and matches no rows.
+//
+// Parameters:
+//
+//	ctx (context.Context): Context of the query. An ambient transaction from WithTransaction is joined.
+//	db (*PostgreSQL): Database to query.
+//	keyFn (func(V) K): Returns the key of a row, e.g. its ID.
+//	conds (...interface{}): Conditions, in the forms accepted by Find.
+//
+// Returns:
+//
+//	map[K]V: The rows keyed by keyFn.
+//	error: An error if the query fails.
+//
+// Example:
+//
+//	db := database.New(...)
+//	users, err := database.FindMap(ctx, db, func(u User) uint { return u.ID }, "id IN ?", ids)
+//	if err != nil {
+//	    fmt.Println("Error finding users:", err)
+//	}
+func FindMap[K comparable, V any](ctx context.Context, db *PostgreSQL, keyFn func(V) K, conds ...interface{}) (map[K]V, error) {
+	if matchesNothing(conds) {
+		return map[K]V{}, nil
+	}
+
+	var rows []V
+	if err := db.Conn(ctx).Find(&rows, conds...).Error; err != nil {
+		return nil, fmt.Errorf("failed to find map; %s", err.Error())
+	}
+
+	result := make(map[K]V, len(rows))
+	for _, row := range rows {
+		result[keyFn(row)] = row
+	}
+	return result, nil
+}
+
+// emptyInCondition matches a condition of the form "column IN ?".
+var emptyInCondition = regexp.MustCompile(`(?i)^\s*[\w."]+\s+IN\s+\?\s*$`)
+
+// matchesNothing reports whether conds is a single "column IN ?" condition bound to an empty
+// slice, which matches no rows.
+func matchesNothing(conds []interface{}) bool {
+	if len(conds) != 2 {
+		return false
+	}
+	query, ok := conds[0].(string)
+	if !ok || !emptyInCondition.MatchString(query) {
+		return false
+	}
+
+	// An empty []byte is a single bytea value, not an empty list.
+	value := reflect.ValueOf(conds[1])
+	return value.Kind() == reflect.Slice && value.Len() == 0 && value.Type().Elem().Kind() != reflect.Uint8
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"testing"
+)
+
+func TestLookupHelpersSkipEmptyInput(t *testing.T) {
+	ctx := context.Background()
+	db, connector := newFakeDB(t)
+
+	rows := []testCounter{{ID: 1}}
+	if err := db.FindByTuples(ctx, &rows, []string{"id", "name"}, nil); err != nil {
+		t.Fatalf("FindByTuples failed; %s", err.Error())
+	}
+	if rows == nil || len(rows) != 0 {
+		t.Errorf("FindByTuples stored %v; want an empty slice", rows)
+	}
+
+	counters, err := FindMap(ctx, db, func(c testCounter) uint { return c.ID }, "id IN ?", []uint{})
+	if err != nil {
+		t.Fatalf("FindMap failed; %s", err.Error())
+	}
+	if counters == nil || len(counters) != 0 {
+		t.Errorf("FindMap = %v; want an empty map", counters)
+	}
+
+	if sent := connector.sent(); len(sent) != 0 {
+		t.Errorf("statements sent for empty input: %q", sent)
+	}
+}
+
+func TestFindMapQueriesOtherConditions(t *testing.T) {
+	ctx := context.Background()
+	db, connector := newFakeDB(t)
+
+	tests := []struct {
+		name  string
+		conds []interface{}
+	}{
+		{"no conditions", nil},
+		{"non-empty list", []interface{}{"id IN ?", []uint{1, 2}}},
+		{"NOT IN", []interface{}{"id NOT IN ?", []uint{}}},
+		{"combined condition", []interface{}{"id IN ? OR hits > 0", []uint{}}},
+		{"empty bytea", []interface{}{"name IN ?", []byte{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(connector.sent())
+			if _, err := FindMap(ctx, db, func(c testCounter) uint { return c.ID }, tt.conds...); err != nil {
+				t.Fatalf("FindMap failed; %s", err.Error())
+			}
+			if sent := connector.sent(); len(sent) != before+1 {
+				t.Errorf("sent %d statements; want 1", len(sent)-before)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Package database provides VACUUM and ANALYZE helpers for PostgreSQL maintenance jobs.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+Analyze and Vacuum run the corresponding commands on the primary, outside of any ambient
+transaction since VACUUM cannot run inside one. Table names are quoted, so they may come
+from configuration; a schema-qualified name such as "sales.orders" is quoted part by part.
+
+Example usage:
+
+	// Refresh planner statistics after a bulk load.
+	if err := db.Analyze(ctx, "orders", "order_items"); err != nil {
+	    log.Println(err)
+	}
+
+	// Reclaim space and refresh statistics of the whole database.
+	err := db.Vacuum(ctx, database.VacuumOptions{Analyze: true})
+*/
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// VacuumOptions configures a VACUUM run by Vacuum.
+type VacuumOptions struct {
+	Full    bool     // Rewrite the tables to reclaim all free space. Takes an exclusive lock on each table. Default is false.
+	Analyze bool     // Also refresh planner statistics. Default is false.
+	Tables  []string // Tables to vacuum, optionally schema-qualified. Default is none, vacuuming every table the user may vacuum.
+}
+
+// Analyze refreshes the planner statistics of tables, or of every table in the database when
+// none is given.
+//
+// Parameters:
+//
+//	ctx (context.Context): Context bounding the command.
+//	tables (...string): Tables to analyze, optionally schema-qualified.
+//
+// Returns:
+//
+//	error: An error if the command fails.
+//
+// Example:
+//
+//	db := database.New(...)
+//	if err := db.Analyze(ctx, "orders"); err != nil {
+//	    fmt.Println("Error analyzing orders:", err)
+//	}
+func (db *PostgreSQL) Analyze(ctx context.Context, tables ...string) error {
+	if err := db.DB.WithContext(ctx).Exec("ANALYZE" + tableList(tables)).Error; err != nil {
+		return fmt.Errorf("failed to analyze; %s", err.Error())
+	}
+	return nil
+}
+
+// Vacuum runs VACUUM with opts. It always runs on its own, outside of any transaction stored
+// in ctx.
+//
+// Parameters:
+//
+//	ctx (context.Context): Context bounding the command.
+//	opts (VacuumOptions): Tables to vacuum and whether to run VACUUM FULL and ANALYZE.
+//
+// Returns:
+//
+//	error: An error if the command fails.
+//
+// Example:
+//
+//	db := database.New(...)
+//	err := db.Vacuum(ctx, database.VacuumOptions{Analyze: true, Tables: []string{"events"}})
+//	if err != nil {
+//	    fmt.Println("Error vacuuming events:", err)
+//	}
+func (db *PostgreSQL) Vacuum(ctx context.Context, opts VacuumOptions) error {
+	var settings []string
+	if opts.Full {
+		settings = append(settings, "FULL")
+	}
+	if opts.Analyze {
+		settings = append(settings, "ANALYZE")
+	}
+
+	stmt := "VACUUM"
+	if len(settings) > 0 {
+		stmt += " (" + strings.Join(settings, ", ") + ")"
+	}
+	if err := db.DB.WithContext(ctx).Exec(stmt + tableList(opts.Tables)).Error; err != nil {
+		return fmt.Errorf("failed to vacuum; %s", err.Error())
+	}
+	return nil
+}
+
+// tableList returns the quoted, comma-separated tables preceded by a space, or "" for none.
+func tableList(tables []string) string {
+	if len(tables) == 0 {
+		return ""
+	}
+
+	quoted := make([]string, len(tables))
+	for i, table := range tables {
+		quoted[i] = quoteQualifiedName(table)
+	}
+	return " " + strings.Join(quoted, ", ")
+}
+
+// quoteQualifiedName quotes each dot-separated part of name, e.g. "sales.orders".
+func quoteQualifiedName(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = QuoteIdentifier(part)
+	}
+	return strings.Join(parts, ".")
+}
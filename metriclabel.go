@@ -0,0 +1,170 @@
+/*
+Package database provides metric labels attributing statements to their callers.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+WithMetricLabel returns a session whose statements are reported to QueryMetrics under a
+label, e.g. the HTTP endpoint that issued them, showing which endpoints generate the most or
+the slowest queries without high-cardinality SQL fingerprints. Labels are validated, and
+only the first MaxMetricLabels distinct labels are reported as given; later ones are
+reported as OtherMetricLabel, so the number of label values stays bounded.
+
+Example usage:
+
+	func (m *promMetrics) ObserveQuery(label string, d time.Duration, err error) {
+	    m.queries.WithLabelValues(label).Observe(d.Seconds()) // endpoint="GET /users"
+	}
+
+	func listUsers(w http.ResponseWriter, r *http.Request) {
+	    var users []User
+	    db.WithMetricLabel("GET /users").WithContext(r.Context()).Find(&users)
+	}
+*/
+
+package database
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidMetricLabel is returned by statements of a session created with an invalid label.
+var ErrInvalidMetricLabel = errors.New("invalid metric label")
+
+// MaxMetricLabels is the number of distinct labels reported as given; statements with further
+// labels are reported as OtherMetricLabel. It is read when the database is created.
+var MaxMetricLabels = 100
+
+// OtherMetricLabel is the label reported for statements beyond MaxMetricLabels distinct labels.
+const OtherMetricLabel = "other"
+
+// metricLabelSetting is the statement setting holding the label of a session returned by WithMetricLabel.
+const metricLabelSetting = "database:metric_label"
+
+// queryStartKey is the statement instance key holding the time a statement started.
+const queryStartKey = "database:query_start"
+
+// metricLabelPattern matches valid labels: up to 64 letters, digits, spaces and _ . / : { } -,
+// enough for route patterns such as "GET /users/{id}".
+var metricLabelPattern = regexp.MustCompile(`^[A-Za-z0-9 _./:{}-]{1,64}$`)
+
+// WithMetricLabel returns a session whose statements are reported to QueryMetrics under label.
+// Use route patterns rather than concrete paths, e.g. "GET /users/{id}" instead of
+// "GET /users/42", so every request of an endpoint shares one label. A label that is empty,
+// longer than 64 bytes or contains other characters than letters, digits, spaces and
+// _ . / : { } - fails every statement of the session with ErrInvalidMetricLabel.
+//
+// Example:
+//
+//	db := database.New(...)
+//	err := db.WithMetricLabel("POST /orders").Create(&order).Error
+func (db *PostgreSQL) WithMetricLabel(label string) *gorm.DB {
+	conn := db.DB.Session(&gorm.Session{})
+	if !metricLabelPattern.MatchString(label) {
+		conn.AddError(fmt.Errorf("%w; %q", ErrInvalidMetricLabel, label))
+		return conn
+	}
+	return conn.Set(metricLabelSetting, label).Session(&gorm.Session{})
+}
+
+// registerQueryMetrics registers callbacks reporting the duration of every statement to m.
+func registerQueryMetrics(gormDB *gorm.DB, m QueryMetrics) error {
+	observe := observeQuery(m, &metricLabels{max: MaxMetricLabels, seen: make(map[string]struct{})})
+	cb := gormDB.Callback()
+
+	// Create, update and delete are timed including their default transaction.
+	if err := cb.Create().Before("gorm:begin_transaction").Register("database:query_start", startQuery); err != nil {
+		return err
+	}
+	if err := cb.Create().After("gorm:commit_or_rollback_transaction").Register("database:query_metrics", observe); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:begin_transaction").Register("database:query_start", startQuery); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:commit_or_rollback_transaction").Register("database:query_metrics", observe); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:begin_transaction").Register("database:query_start", startQuery); err != nil {
+		return err
+	}
+	if err := cb.Delete().After("gorm:commit_or_rollback_transaction").Register("database:query_metrics", observe); err != nil {
+		return err
+	}
+	if err := cb.Query().Before("gorm:query").Register("database:query_start", startQuery); err != nil {
+		return err
+	}
+	if err := cb.Query().After("gorm:query").Register("database:query_metrics", observe); err != nil {
+		return err
+	}
+	if err := cb.Raw().Before("gorm:raw").Register("database:query_start", startQuery); err != nil {
+		return err
+	}
+	if err := cb.Raw().After("gorm:raw").Register("database:query_metrics", observe); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:row").Register("database:query_start", startQuery); err != nil {
+		return err
+	}
+	// Rows are still being read when the callback chain ends; only sending the query is timed.
+	return cb.Row().After("gorm:row").Register("database:query_metrics", observe)
+}
+
+// startQuery records the time the statement started.
+func startQuery(tx *gorm.DB) {
+	if tx.Error != nil || tx.DryRun {
+		return
+	}
+	tx.InstanceSet(queryStartKey, time.Now())
+}
+
+// observeQuery returns a callback reporting the statement's label, duration and error to m.
+func observeQuery(m QueryMetrics, labels *metricLabels) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		v, _ := tx.InstanceGet(queryStartKey)
+		start, ok := v.(time.Time)
+		if !ok {
+			return
+		}
+		tx.InstanceSet(queryStartKey, nil)
+
+		label, _ := tx.Get(metricLabelSetting)
+		name, _ := label.(string)
+		m.ObserveQuery(labels.bound(name), time.Since(start), tx.Error)
+	}
+}
+
+// metricLabels bounds the number of distinct labels reported.
+type metricLabels struct {
+	mu   sync.Mutex
+	max  int
+	seen map[string]struct{}
+}
+
+// bound returns label when it is among the first max distinct labels seen, and
+// OtherMetricLabel otherwise. The empty label is always returned as is.
+func (l *metricLabels) bound(label string) string {
+	if label == "" {
+		return ""
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.seen[label]; ok {
+		return label
+	}
+	if len(l.seen) >= l.max {
+		return OtherMetricLabel
+	}
+	l.seen[label] = struct{}{}
+	return label
+}
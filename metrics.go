@@ -0,0 +1,71 @@
+/*
+Package database provides a metrics hook for PostgreSQL connections.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+A Metrics implementation set in Config.Metrics is called by the helpers of this package, so
+their behavior can be exported to a monitoring system such as Prometheus without this
+package depending on one. Transactions started by WithTransaction report their outcome,
+number of retries and duration; rising rollback or retry rates often signal contention or
+bugs. Implementations of PreparedStatementMetrics also observe prepared statement cache hits
+and misses, and implementations of QueryMetrics observe every statement under the label set
+with WithMetricLabel, e.g. the HTTP endpoint that issued it.
+
+Example usage:
+
+	type promMetrics struct {
+	    outcomes *prometheus.CounterVec   // labels: outcome
+	    retries  prometheus.Counter
+	    duration *prometheus.HistogramVec // labels: outcome
+	}
+
+	func (m *promMetrics) ObserveTransaction(outcome string, retries int, d time.Duration) {
+	    m.outcomes.WithLabelValues(outcome).Inc()
+	    m.retries.Add(float64(retries))
+	    m.duration.WithLabelValues(outcome).Observe(d.Seconds())
+	}
+
+	cfg.Metrics = &promMetrics{...}
+	db, _ := database.CreatePostgreSQL(cfg)
+*/
+
+package database
+
+import "time"
+
+// Transaction outcomes reported to Metrics.ObserveTransaction.
+const (
+	TxCommitted  = "committed"
+	TxRolledBack = "rolled_back"
+)
+
+// Metrics receives measurements from the helpers of this package. Implementations must be
+// safe for concurrent use.
+type Metrics interface {
+	// ObserveTransaction is called once per transaction started by WithTransaction with its
+	// outcome, TxCommitted or TxRolledBack, the number of times it was retried before that
+	// outcome and its total duration, including retries. Transactions that could not be
+	// started are not reported. Retries are made with TxRetries.
+	ObserveTransaction(outcome string, retries int, d time.Duration)
+}
+
+// PreparedStatementMetrics is implemented by Metrics that also observe the prepared statement
+// cache enabled by Config.PrepareStmt. It is a separate interface so existing Metrics
+// implementations keep compiling.
+type PreparedStatementMetrics interface {
+	// ObservePreparedStatement is called once per statement run through the prepared
+	// statement cache, with hit set when its SQL was already prepared.
+	ObservePreparedStatement(hit bool)
+}
+
+// QueryMetrics is implemented by Metrics that also observe individual statements, labeled
+// with WithMetricLabel.
+type QueryMetrics interface {
+	// ObserveQuery is called once per statement with the label of the session it was issued
+	// from, "" when unlabeled or OtherMetricLabel beyond MaxMetricLabels distinct labels, its
+	// duration and its error, if any.
+	ObserveQuery(label string, d time.Duration, err error)
+}
@@ -0,0 +1,93 @@
+/*
+Package database provides a partition-aware wrapper around GORM's AutoMigrate.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+GORM's AutoMigrate does not understand natively partitioned tables and will try to
+create or alter them like regular tables. Models backed by a partitioned table implement
+Partitioner to be excluded from AutoMigrate; their partitions are managed by the model
+itself through PartitionEnsurer, or entirely outside of this package.
+
+Example usage:
+
+	type Event struct {
+	    ID        uint
+	    CreatedAt time.Time
+	}
+
+	func (Event) Partitioned() bool { return true }
+
+	func (Event) EnsurePartitions(tx *gorm.DB) error {
+	    return tx.Exec(`CREATE TABLE IF NOT EXISTS events_2024 PARTITION OF events
+	        FOR VALUES FROM ('2024-01-01') TO ('2025-01-01')`).Error
+	}
+
+	err := db.Migrate(&User{}, &Event{}) // migrates User, only ensures Event partitions
+*/
+
+package database
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// Partitioner is implemented by models backed by a natively partitioned table. Models
+// reporting true are skipped by Migrate.
+type Partitioner interface {
+	Partitioned() bool
+}
+
+// PartitionEnsurer is implemented by partitioned models that create their own partitions.
+// Migrate calls EnsurePartitions instead of migrating the table.
+type PartitionEnsurer interface {
+	EnsurePartitions(tx *gorm.DB) error
+}
+
+// Migrate runs AutoMigrate for the given models, skipping models that implement Partitioner
+// and report themselves as partitioned. Skipped models implementing PartitionEnsurer have
+// their EnsurePartitions method called instead.
+//
+// Parameters:
+//
+//	models (...interface{}): Pointers to the models to migrate.
+//
+// Returns:
+//
+//	error: An error if migrating a model or ensuring its partitions fails.
+//
+// Example:
+//
+//	db := database.New(...)
+//	err := db.Migrate(&User{}, &Event{})
+//	if err != nil {
+//	    fmt.Println("Error migrating models:", err)
+//	}
+func (db *PostgreSQL) Migrate(models ...interface{}) error {
+	migrate := make([]interface{}, 0, len(models))
+	for _, model := range models {
+		if p, ok := model.(Partitioner); ok && p.Partitioned() {
+			if e, ok := model.(PartitionEnsurer); ok {
+				if err := e.EnsurePartitions(db.DB); err != nil {
+					return fmt.Errorf("failed to ensure partitions for %T; %s", model, err.Error())
+				}
+			}
+			continue
+		}
+		migrate = append(migrate, model)
+	}
+
+	if len(migrate) == 0 {
+		return nil
+	}
+
+	if err := db.DB.AutoMigrate(migrate...); err != nil {
+		return fmt.Errorf("failed to migrate models; %s", err.Error())
+	}
+
+	return nil
+}
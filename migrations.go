@@ -0,0 +1,296 @@
+/*
+Package database provides a runner for versioned SQL migration files.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+Migration files are named "<version>_<description>.sql", e.g. "0001_create_users.sql", and
+are applied in version order. Each file runs in its own transaction together with the
+insert recording it in the migrations table, so a failing file leaves no partial record.
+
+The SHA-256 checksum of every applied file is recorded. In strict mode, ApplyMigrations
+refuses to run when a previously applied file has been modified since, which indicates that
+migration history was edited after being applied.
+
+Example usage:
+
+	//go:embed migrations/*.sql
+	var migrations embed.FS
+
+	sub, _ := fs.Sub(migrations, "migrations")
+	err := db.ApplyMigrations(ctx, sub, database.MigrationOptions{Strict: true})
+	if errors.Is(err, database.ErrMigrationModified) {
+	    log.Fatal(err) // names the file and shows both checksums
+	}
+*/
+
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// DefaultMigrationTable is the table recording applied migrations when MigrationOptions.Table is empty.
+const DefaultMigrationTable = "schema_migrations"
+
+// Errors returned by ApplyMigrations and RequireSchemaVersion.
+var (
+	ErrMigrationModified = errors.New("applied migration has been modified")
+	ErrSchemaOutdated    = errors.New("schema version is older than required")
+)
+
+// MigrationOptions configures ApplyMigrations, SchemaVersion and RequireSchemaVersion.
+type MigrationOptions struct {
+	Table  string // Table recording applied migrations. Default is "schema_migrations".
+	Strict bool   // Refuse to run when an applied migration file has been modified. Default is false.
+}
+
+// table returns the migrations table of o.
+func (o MigrationOptions) table() string {
+	if o.Table == "" {
+		return DefaultMigrationTable
+	}
+	return o.Table
+}
+
+// schemaVersionTable returns the migrations table selected by the optional opts of
+// SchemaVersion and RequireSchemaVersion.
+func schemaVersionTable(opts []MigrationOptions) string {
+	if len(opts) == 0 {
+		return DefaultMigrationTable
+	}
+	return opts[0].table()
+}
+
+// migrationFile is a migration file read from the migrations directory.
+type migrationFile struct {
+	version  int64
+	name     string
+	sql      string
+	checksum string
+}
+
+// appliedMigration is a row of the migrations table.
+type appliedMigration struct {
+	Version  int64
+	Name     string
+	Checksum string
+}
+
+// ApplyMigrations applies the SQL migration files in the root of fsys that have not been
+// applied yet, in version order.
+//
+// Parameters:
+//
+//	ctx (context.Context): Context bounding the migration run.
+//	fsys (fs.FS): File system holding the "<version>_<description>.sql" files.
+//	opts (MigrationOptions): Migrations table name and strict mode.
+//
+// Returns:
+//
+//	error: An error if reading, verifying or applying a migration fails. In strict mode the
+//	error wraps ErrMigrationModified when an applied file has changed.
+//
+// Example:
+//
+//	db := database.New(...)
+//	err := db.ApplyMigrations(ctx, os.DirFS("migrations"), database.MigrationOptions{Strict: true})
+//	if err != nil {
+//	    fmt.Println("Error applying migrations:", err)
+//	}
+func (db *PostgreSQL) ApplyMigrations(ctx context.Context, fsys fs.FS, opts MigrationOptions) error {
+	table := opts.table()
+
+	files, err := readMigrationFiles(fsys)
+	if err != nil {
+		return err
+	}
+
+	conn := db.DB.WithContext(ctx)
+	if err := conn.Exec(fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (version BIGINT PRIMARY KEY, name TEXT NOT NULL, checksum TEXT NOT NULL, applied_at TIMESTAMPTZ NOT NULL DEFAULT now())",
+		QuoteIdentifier(table),
+	)).Error; err != nil {
+		return fmt.Errorf("failed to create migration table; %s", err.Error())
+	}
+
+	applied, err := appliedMigrations(conn, table)
+	if err != nil {
+		return err
+	}
+
+	if opts.Strict {
+		for _, f := range files {
+			if a, ok := applied[f.version]; ok && a.Checksum != f.checksum {
+				return fmt.Errorf("%w; %s: applied checksum %s, file checksum %s", ErrMigrationModified, f.name, a.Checksum, f.checksum)
+			}
+		}
+	}
+
+	for _, f := range files {
+		if _, ok := applied[f.version]; ok {
+			continue
+		}
+		if err := applyMigration(conn, table, f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readMigrationFiles reads the migration files in the root of fsys, sorted by version.
+func readMigrationFiles(fsys fs.FS) ([]migrationFile, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations; %s", err.Error())
+	}
+
+	var files []migrationFile
+	seen := make(map[int64]string)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || path.Ext(name) != ".sql" {
+			continue
+		}
+
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.ParseInt(strings.TrimSuffix(prefix, ".sql"), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s; name must start with a numeric version", name)
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("failed to read migration %s; version %d already used by %s", name, version, other)
+		}
+		seen[version] = name
+
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s; %s", name, err.Error())
+		}
+
+		sum := sha256.Sum256(content)
+		files = append(files, migrationFile{
+			version:  version,
+			name:     name,
+			sql:      string(content),
+			checksum: hex.EncodeToString(sum[:]),
+		})
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].version < files[j].version })
+	return files, nil
+}
+
+// appliedMigrations returns the migrations recorded in table, keyed by version.
+func appliedMigrations(conn *gorm.DB, table string) (map[int64]appliedMigration, error) {
+	var rows []appliedMigration
+	if err := conn.Raw(fmt.Sprintf("SELECT version, name, checksum FROM %s", QuoteIdentifier(table))).Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations; %s", err.Error())
+	}
+
+	applied := make(map[int64]appliedMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// applyMigration runs f and records it in table within a single transaction. A transaction
+// level advisory lock keeps concurrent runners from applying the same file twice.
+func applyMigration(conn *gorm.DB, table string, f migrationFile) error {
+	return conn.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", table).Error; err != nil {
+			return fmt.Errorf("failed to lock migrations; %s", err.Error())
+		}
+
+		var exists bool
+		if err := tx.Raw(fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s WHERE version = ?)", QuoteIdentifier(table)), f.version).Scan(&exists).Error; err != nil {
+			return fmt.Errorf("failed to check migration %s; %s", f.name, err.Error())
+		}
+		if exists {
+			return nil
+		}
+
+		if err := tx.Exec(f.sql).Error; err != nil {
+			return fmt.Errorf("failed to apply migration %s; %s", f.name, err.Error())
+		}
+
+		if err := tx.Exec(
+			fmt.Sprintf("INSERT INTO %s (version, name, checksum) VALUES (?, ?, ?)", QuoteIdentifier(table)),
+			f.version, f.name, f.checksum,
+		).Error; err != nil {
+			return fmt.Errorf("failed to record migration %s; %s", f.name, err.Error())
+		}
+
+		return nil
+	})
+}
+
+// SchemaVersion returns the highest migration version recorded by ApplyMigrations, or 0 when
+// no migration has been applied yet. Pass the MigrationOptions given to ApplyMigrations when
+// it uses a table other than DefaultMigrationTable; only Table is read.
+//
+// Example:
+//
+//	db := database.New(...)
+//	version, err := db.SchemaVersion(ctx, database.MigrationOptions{Table: "app_migrations"})
+//	if err != nil {
+//	    fmt.Println("Error reading schema version:", err)
+//	}
+func (db *PostgreSQL) SchemaVersion(ctx context.Context, opts ...MigrationOptions) (int, error) {
+	conn := db.DB.WithContext(ctx)
+	table := QuoteIdentifier(schemaVersionTable(opts))
+
+	// The table is checked separately: a query referencing a missing table fails to plan.
+	var exists bool
+	if err := conn.Raw("SELECT to_regclass(?) IS NOT NULL", table).Scan(&exists).Error; err != nil {
+		return 0, fmt.Errorf("failed to read schema version; %s", err.Error())
+	}
+	if !exists {
+		return 0, nil
+	}
+
+	var version int64
+	if err := conn.Raw(fmt.Sprintf("SELECT COALESCE(MAX(version), 0) FROM %s", table)).Scan(&version).Error; err != nil {
+		return 0, fmt.Errorf("failed to read schema version; %s", err.Error())
+	}
+
+	return int(version), nil
+}
+
+// RequireSchemaVersion returns an error wrapping ErrSchemaOutdated unless the schema version
+// is at least min. Use it in readiness probes so traffic is only served once migrations,
+// e.g. from an init container, have completed. opts selects the migrations table as in
+// SchemaVersion.
+//
+// Example:
+//
+//	http.HandleFunc("/ready", func(w http.ResponseWriter, r *http.Request) {
+//	    if err := db.RequireSchemaVersion(r.Context(), 42); err != nil {
+//	        http.Error(w, err.Error(), http.StatusServiceUnavailable)
+//	    }
+//	})
+func (db *PostgreSQL) RequireSchemaVersion(ctx context.Context, min int, opts ...MigrationOptions) error {
+	version, err := db.SchemaVersion(ctx, opts...)
+	if err != nil {
+		return err
+	}
+	if version < min {
+		return fmt.Errorf("%w; have %d, want %d", ErrSchemaOutdated, version, min)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestSchemaVersionReadsMigrationTable(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  []MigrationOptions
+		table string
+	}{
+		{"default", nil, `"schema_migrations"`},
+		{"empty table", []MigrationOptions{{}}, `"schema_migrations"`},
+		{"custom table", []MigrationOptions{{Table: "app_migrations"}}, `"app_migrations"`},
+		{"quoted", []MigrationOptions{{Table: `odd"name`}}, `"odd""name"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, connector := newFakeDB(t)
+
+			err := db.RequireSchemaVersion(context.Background(), 1, tt.opts...)
+			if !errors.Is(err, ErrSchemaOutdated) {
+				t.Fatalf("RequireSchemaVersion() = %v; want ErrSchemaOutdated", err)
+			}
+
+			args := connector.sentArgs()
+			if len(args) != 1 || len(args[0]) != 1 {
+				t.Fatalf("sent arguments = %v; want the table of the to_regclass lookup", args)
+			}
+			if got := args[0][0].Value; got != tt.table {
+				t.Errorf("to_regclass(%v); want %s", got, tt.table)
+			}
+		})
+	}
+}
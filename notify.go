@@ -0,0 +1,282 @@
+/*
+Package database provides LISTEN/NOTIFY helpers for PostgreSQL connections.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+Notify sends a notification with pg_notify. Sent inside WithTransaction, the notification is
+delivered to listeners only when the transaction commits, and not at all on rollback.
+
+Payloads must be shorter than 8000 bytes in the server's default configuration. Notify
+rejects larger payloads with ErrPayloadTooLarge up front; to pass more data, store it in a
+table and notify with its id, letting listeners load the row.
+
+Listen receives notifications on a dedicated pooled connection. When that connection
+drops, the listener reconnects and issues LISTEN again. Notifications sent while it was
+disconnected are lost, so the listener delivers Disconnected and Reconnected events on the
+same channel as the notifications, letting consumers re-sync their state after a gap.
+
+Example usage:
+
+	err := db.WithTransaction(ctx, func(ctx context.Context) error {
+	    if err := db.Conn(ctx).Create(&job).Error; err != nil {
+	        return err
+	    }
+	    return db.Notify(ctx, "jobs", strconv.FormatUint(uint64(job.ID), 10))
+	})
+
+	events, err := db.Listen(ctx, "jobs")
+	for n := range events {
+	    switch n.Event {
+	    case database.Notified:
+	        runJob(n.Payload)
+	    case database.Reconnected:
+	        runPendingJobs() // notifications sent during the gap were lost
+	    }
+	}
+
+Notes:
+  - Each Listen call holds one pooled connection until ctx is done or Close is called.
+  - The connection is discarded rather than returned to the pool when the listener stops,
+    so no other session inherits its LISTEN registrations.
+*/
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// MaxNotifyPayload is the size in bytes that notification payloads must stay below.
+const MaxNotifyPayload = 8000
+
+// ErrPayloadTooLarge is returned by Notify for payloads of MaxNotifyPayload bytes or more.
+var ErrPayloadTooLarge = errors.New("notification payload too large")
+
+// ListenReconnectInterval is the time a listener waits between two attempts to reconnect.
+var ListenReconnectInterval = time.Second
+
+// ListenEvent is the kind of an event delivered by Listen.
+type ListenEvent int
+
+// Events delivered by Listen.
+const (
+	Notified     ListenEvent = iota // A notification was received.
+	Disconnected                    // The connection dropped; notifications are lost until Reconnected.
+	Reconnected                     // The listener is listening again on a new connection.
+)
+
+// Notification is an event delivered by Listen: a notification received on one of the
+// channels or a change of the listener's connection state.
+type Notification struct {
+	Event   ListenEvent // Kind of event.
+	Channel string      // Channel the notification was sent to. Empty for connection events.
+	Payload string      // Payload of the notification. Empty for connection events.
+	PID     uint32      // Process ID of the notifying server session. Zero for connection events.
+	Err     error       // Error that broke the connection, for Disconnected events.
+}
+
+// Notify sends payload to the listeners of channel. An ambient transaction from
+// WithTransaction is joined, deferring delivery until it commits.
+//
+// Parameters:
+//
+//	ctx (context.Context): Context of the notification.
+//	channel (string): Channel name, as used in LISTEN.
+//	payload (string): Payload, shorter than MaxNotifyPayload bytes.
+//
+// Returns:
+//
+//	error: An error wrapping ErrPayloadTooLarge if the payload is too large, or an error if
+//	the notification fails.
+//
+// Example:
+//
+//	db := database.New(...)
+//	if err := db.Notify(ctx, "cache_invalidation", "users:42"); err != nil {
+//	    fmt.Println("Error notifying:", err)
+//	}
+func (db *PostgreSQL) Notify(ctx context.Context, channel, payload string) error {
+	if len(payload) >= MaxNotifyPayload {
+		return fmt.Errorf("%w; %d bytes, must be less than %d; store the data in a table and notify with its id", ErrPayloadTooLarge, len(payload), MaxNotifyPayload)
+	}
+
+	if err := db.Conn(ctx).Exec("SELECT pg_notify(?, ?)", channel, payload).Error; err != nil {
+		return fmt.Errorf("failed to notify %s; %s", channel, err.Error())
+	}
+
+	return nil
+}
+
+// Listen listens on channels with a dedicated pooled connection and delivers notifications and
+// connection state events on the returned channel. When the connection drops, a Disconnected
+// event is delivered and the listener reconnects every ListenReconnectInterval until it
+// succeeds, then delivers a Reconnected event. The returned channel is closed once ctx is done
+// or Close is called.
+//
+// Events are delivered unbuffered; while the consumer is busy, notifications queue up on the
+// connection.
+//
+// Parameters:
+//
+//	ctx (context.Context): Context bounding the lifetime of the listener.
+//	channels (...string): Channel names, as used in Notify.
+//
+// Returns:
+//
+//	<-chan Notification: Notifications and connection state events.
+//	error: An error if no channel is given or the first LISTEN fails.
+//
+// Example:
+//
+//	db := database.New(...)
+//	events, err := db.Listen(ctx, "cache_invalidation")
+//	if err != nil {
+//	    fmt.Println("Error listening:", err)
+//	}
+//	for n := range events {
+//	    if n.Event == database.Notified {
+//	        cache.Delete(n.Payload)
+//	    } else if n.Event == database.Reconnected {
+//	        cache.Clear()
+//	    }
+//	}
+func (db *PostgreSQL) Listen(ctx context.Context, channels ...string) (<-chan Notification, error) {
+	if len(channels) == 0 {
+		return nil, fmt.Errorf("failed to listen; no channel given")
+	}
+
+	sqlDB, err := db.DB.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sql db; %s", err.Error())
+	}
+
+	l := &listener{pool: sqlDB, channels: channels, events: make(chan Notification)}
+	conn, err := l.connect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen; %s", err.Error())
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-db.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	go func() {
+		defer cancel()
+		l.run(ctx, conn)
+	}()
+	return l.events, nil
+}
+
+// listener receives notifications for Listen.
+type listener struct {
+	pool     *sql.DB
+	channels []string
+	events   chan Notification
+}
+
+// run delivers notifications received on conn, reconnecting whenever the connection drops,
+// until ctx is done.
+func (l *listener) run(ctx context.Context, conn *sql.Conn) {
+	defer close(l.events)
+
+	for {
+		err := l.receive(ctx, conn)
+		if ctx.Err() != nil || !l.send(ctx, Notification{Event: Disconnected, Err: err}) {
+			return
+		}
+
+		if conn = l.reconnect(ctx); conn == nil || !l.send(ctx, Notification{Event: Reconnected}) {
+			return
+		}
+	}
+}
+
+// connect acquires a pooled connection and listens on the channels.
+func (l *listener) connect(ctx context.Context) (*sql.Conn, error) {
+	conn, err := l.pool.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = conn.Raw(func(driverConn interface{}) error {
+		c, ok := driverConn.(interface{ Conn() *pgx.Conn })
+		if !ok {
+			return fmt.Errorf("unsupported driver connection %T", driverConn)
+		}
+		for _, channel := range l.channels {
+			if _, err := c.Conn().Exec(ctx, "LISTEN "+QuoteIdentifier(channel)); err != nil {
+				// Discard the connection, which may already listen on other channels.
+				return badConnError{err: err}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// reconnect connects again every ListenReconnectInterval until it succeeds. It returns nil
+// once ctx is done.
+func (l *listener) reconnect(ctx context.Context) *sql.Conn {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(ListenReconnectInterval):
+		}
+
+		if conn, err := l.connect(ctx); err == nil {
+			return conn
+		}
+	}
+}
+
+// receive delivers the notifications received on conn until the connection fails or ctx is
+// done, and returns the error that ended it. conn is discarded afterwards.
+func (l *listener) receive(ctx context.Context, conn *sql.Conn) error {
+	defer conn.Close()
+
+	var cause error
+	conn.Raw(func(driverConn interface{}) error {
+		c := driverConn.(interface{ Conn() *pgx.Conn })
+		for {
+			n, err := c.Conn().WaitForNotification(ctx)
+			if err != nil {
+				cause = err
+				// The connection still listens, so it must not be reused.
+				return badConnError{err: err}
+			}
+			if !l.send(ctx, Notification{Event: Notified, Channel: n.Channel, Payload: n.Payload, PID: n.PID}) {
+				cause = ctx.Err()
+				return badConnError{err: cause}
+			}
+		}
+	})
+	return cause
+}
+
+// send delivers n unless ctx is done first. It reports whether n was delivered.
+func (l *listener) send(ctx context.Context, n Notification) bool {
+	select {
+	case l.events <- n:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
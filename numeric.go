@@ -0,0 +1,210 @@
+/*
+Package database provides an exact type for PostgreSQL numeric columns.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+A numeric column scanned into float64 is rounded to the nearest binary fraction, so money
+amounts such as 0.1 drift and large amounts lose their last digits. Numeric holds the
+decimal value exactly, backed by a big.Rat, and implements sql.Scanner and driver.Valuer, so
+numeric columns round-trip through gorm without loss. It also keeps the number of decimal
+places it was read with, so "12.50" is written back as "12.50".
+
+Example usage:
+
+	type Invoice struct {
+	    ID    uint
+	    Total database.Numeric  `gorm:"type:numeric(20,2)"`
+	    Tip   *database.Numeric `gorm:"type:numeric(20,2)"` // nullable
+	}
+
+	a, _ := database.ParseNumeric("0.1")
+	b, _ := database.ParseNumeric("0.2")
+	fmt.Println(a.Add(b)) // 0.3, where float64 gives 0.30000000000000004
+
+Notes:
+  - NaN and infinite values cannot be represented and fail to scan.
+  - Scanning NULL into a Numeric fails; use *Numeric for nullable columns.
+*/
+
+package database
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// numericPattern matches the finite decimal literals accepted by ParseNumeric.
+var numericPattern = regexp.MustCompile(`^[+-]?(\d+(\.\d*)?|\.\d+)([eE][+-]?\d+)?$`)
+
+// Numeric is an exact decimal value of a PostgreSQL numeric column. The zero value is 0.
+// Numeric values are immutable; arithmetic returns new values.
+type Numeric struct {
+	rat   *big.Rat // nil means zero
+	scale int      // number of decimal places
+}
+
+// ParseNumeric parses a decimal literal such as "12.50", "-3" or "1.5e-3". Fractions such as
+// "1/3", NaN and infinities are rejected.
+//
+// Example:
+//
+//	amount, err := database.ParseNumeric("19.99")
+//	if err != nil {
+//	    fmt.Println("Invalid amount:", err)
+//	}
+func ParseNumeric(s string) (Numeric, error) {
+	if !numericPattern.MatchString(s) {
+		return Numeric{}, fmt.Errorf("failed to parse numeric; %q is not a finite decimal", s)
+	}
+
+	rat, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return Numeric{}, fmt.Errorf("failed to parse numeric; %q is not a finite decimal", s)
+	}
+
+	mantissa, exponent := s, 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		mantissa = s[:i]
+		e, err := strconv.Atoi(s[i+1:])
+		if err != nil {
+			return Numeric{}, fmt.Errorf("failed to parse numeric; %s", err.Error())
+		}
+		exponent = e
+	}
+	scale := 0
+	if _, fraction, ok := strings.Cut(mantissa, "."); ok {
+		scale = len(fraction)
+	}
+	if scale -= exponent; scale < 0 {
+		scale = 0
+	}
+
+	return Numeric{rat: rat, scale: scale}, nil
+}
+
+// NumericFromRat returns the Numeric equal to r, with as many decimal places as needed. It
+// fails when r has no finite decimal representation, e.g. 1/3. r is copied.
+//
+// Example:
+//
+//	share, err := database.NumericFromRat(big.NewRat(1, 8)) // 0.125
+func NumericFromRat(r *big.Rat) (Numeric, error) {
+	// A fraction in lowest terms has a finite decimal representation exactly when its
+	// denominator has no prime factors other than 2 and 5.
+	denom := new(big.Int).Set(r.Denom())
+	twos, fives := 0, 0
+	two, five := big.NewInt(2), big.NewInt(5)
+	mod := new(big.Int)
+	for denom.Cmp(big.NewInt(1)) != 0 {
+		switch {
+		case mod.Mod(denom, two).Sign() == 0:
+			denom.Quo(denom, two)
+			twos++
+		case mod.Mod(denom, five).Sign() == 0:
+			denom.Quo(denom, five)
+			fives++
+		default:
+			return Numeric{}, fmt.Errorf("failed to convert %s to numeric; no finite decimal representation", r.RatString())
+		}
+	}
+
+	scale := twos
+	if fives > scale {
+		scale = fives
+	}
+	return Numeric{rat: new(big.Rat).Set(r), scale: scale}, nil
+}
+
+// value returns the value of n as a big.Rat that must not be modified.
+func (n Numeric) value() *big.Rat {
+	if n.rat == nil {
+		return new(big.Rat)
+	}
+	return n.rat
+}
+
+// Rat returns the value of n as a new big.Rat.
+func (n Numeric) Rat() *big.Rat {
+	return new(big.Rat).Set(n.value())
+}
+
+// Scale returns the number of decimal places of n.
+func (n Numeric) Scale() int {
+	return n.scale
+}
+
+// Add returns n + m. The result has the larger scale of n and m.
+func (n Numeric) Add(m Numeric) Numeric {
+	return Numeric{rat: new(big.Rat).Add(n.value(), m.value()), scale: maxScale(n, m)}
+}
+
+// Sub returns n - m. The result has the larger scale of n and m.
+func (n Numeric) Sub(m Numeric) Numeric {
+	return Numeric{rat: new(big.Rat).Sub(n.value(), m.value()), scale: maxScale(n, m)}
+}
+
+// Mul returns n * m. The result's scale is the sum of the scales of n and m.
+func (n Numeric) Mul(m Numeric) Numeric {
+	return Numeric{rat: new(big.Rat).Mul(n.value(), m.value()), scale: n.scale + m.scale}
+}
+
+// Cmp compares n and m and returns -1, 0 or +1 when n is less than, equal to or greater than m.
+func (n Numeric) Cmp(m Numeric) int {
+	return n.value().Cmp(m.value())
+}
+
+// maxScale returns the larger scale of n and m.
+func maxScale(n, m Numeric) int {
+	if n.scale > m.scale {
+		return n.scale
+	}
+	return m.scale
+}
+
+// String returns n as a decimal literal with Scale decimal places, e.g. "12.50".
+func (n Numeric) String() string {
+	return n.value().FloatString(n.scale)
+}
+
+// GormDataType returns the column type used by AutoMigrate.
+func (Numeric) GormDataType() string {
+	return "numeric"
+}
+
+// Scan implements sql.Scanner.
+func (n *Numeric) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		return fmt.Errorf("failed to scan numeric; value is NULL, use *Numeric for nullable columns")
+	case string:
+		parsed, err := ParseNumeric(v)
+		if err != nil {
+			return err
+		}
+		*n = parsed
+	case []byte:
+		parsed, err := ParseNumeric(string(v))
+		if err != nil {
+			return err
+		}
+		*n = parsed
+	case int64:
+		*n = Numeric{rat: new(big.Rat).SetInt64(v)}
+	default:
+		// Floats are rejected: they have already lost the exact value.
+		return fmt.Errorf("failed to scan numeric; unsupported type %T", src)
+	}
+	return nil
+}
+
+// Value implements driver.Valuer. The value is sent as text, so no precision is lost.
+func (n Numeric) Value() (driver.Value, error) {
+	return n.String(), nil
+}
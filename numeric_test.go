@@ -0,0 +1,97 @@
+package database
+
+import (
+	"math/big"
+	"testing"
+)
+
+// mustParseNumeric parses s or fails the test.
+func mustParseNumeric(t *testing.T, s string) Numeric {
+	t.Helper()
+
+	n, err := ParseNumeric(s)
+	if err != nil {
+		t.Fatalf("ParseNumeric(%q) failed; %s", s, err.Error())
+	}
+	return n
+}
+
+func TestNumericExactArithmetic(t *testing.T) {
+	sum := mustParseNumeric(t, "0.1").Add(mustParseNumeric(t, "0.2"))
+	if sum.Cmp(mustParseNumeric(t, "0.3")) != 0 {
+		t.Errorf("0.1 + 0.2 = %s; want 0.3", sum)
+	}
+	if got := sum.String(); got != "0.3" {
+		t.Errorf("String() = %q; want %q", got, "0.3")
+	}
+
+	if got := mustParseNumeric(t, "19.99").Mul(mustParseNumeric(t, "3")).String(); got != "59.97" {
+		t.Errorf("19.99 * 3 = %s; want 59.97", got)
+	}
+	if got := mustParseNumeric(t, "1.00").Sub(mustParseNumeric(t, "0.015")).String(); got != "0.985" {
+		t.Errorf("1.00 - 0.015 = %s; want 0.985", got)
+	}
+}
+
+func TestNumericRoundTrip(t *testing.T) {
+	tests := []struct {
+		src  interface{}
+		want string
+	}{
+		{"12.50", "12.50"},
+		{[]byte("0.000"), "0.000"},
+		{"-3", "-3"},
+		{"1.5e-3", "0.0015"},
+		{"1.25e1", "12.5"},
+		{int64(42), "42"},
+		// Beyond the precision of float64 and of int64.
+		{"123456789012345678901234567890.123456789012345678901", "123456789012345678901234567890.123456789012345678901"},
+		{"0.000000000000000000000000000001", "0.000000000000000000000000000001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			var n Numeric
+			if err := n.Scan(tt.src); err != nil {
+				t.Fatalf("Scan failed; %s", err.Error())
+			}
+			value, err := n.Value()
+			if err != nil {
+				t.Fatalf("Value failed; %s", err.Error())
+			}
+			if value != tt.want {
+				t.Errorf("Value = %#v; want %q", value, tt.want)
+			}
+
+			var again Numeric
+			if err := again.Scan(value); err != nil {
+				t.Fatalf("Scan of Value failed; %s", err.Error())
+			}
+			if again.Cmp(n) != 0 || again.Scale() != n.Scale() {
+				t.Errorf("round trip = %s; want %s", again, n)
+			}
+		})
+	}
+}
+
+func TestNumericScanRejects(t *testing.T) {
+	for _, src := range []interface{}{nil, "NaN", "Infinity", "-Infinity", "1/3", "", "1.2.3", 0.5} {
+		var n Numeric
+		if err := n.Scan(src); err == nil {
+			t.Errorf("Scan(%#v) = %s; want an error", src, n)
+		}
+	}
+}
+
+func TestNumericFromRat(t *testing.T) {
+	n, err := NumericFromRat(big.NewRat(1, 8))
+	if err != nil {
+		t.Fatalf("NumericFromRat(1/8) failed; %s", err.Error())
+	}
+	if got := n.String(); got != "0.125" {
+		t.Errorf("NumericFromRat(1/8) = %s; want 0.125", got)
+	}
+
+	if _, err := NumericFromRat(big.NewRat(1, 3)); err == nil {
+		t.Error("NumericFromRat(1/3) succeeded; want an error")
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Package database provides offset pagination with total counts.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+Paginated API responses need the rows of a page and the total number of matching rows.
+Page fetches both in a single round-trip by adding the window function count(*) OVER() to
+the page query: the server counts all matching rows before LIMIT and OFFSET apply and
+repeats the total on every returned row.
+
+Compared with a separate COUNT(*) query, the window function saves a round-trip and sees
+the same snapshot as the page, so the total always matches the items. It still reads every
+matching row, so it is no cheaper on the server than a separate count. A page past the last
+one returns no rows and thus no total; Page then runs a separate COUNT(*) to report it.
+
+Example usage:
+
+	users, total, err := database.Page[User](ctx, db, 3, 20, "active = ?", true)
+	if err != nil {
+	    return err
+	}
+	pages := (total + 19) / 20
+*/
+
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+)
+
+// pageTotalColumn is the alias of the window function counting all rows matched by Page.
+const pageTotalColumn = "database_page_total"
+
+// pageRow is a row read by Page: the item and the total number of matching rows.
+type pageRow[T any] struct {
+	Item  T     `gorm:"embedded"`
+	Total int64 `gorm:"column:database_page_total"`
+}
+
+// Page returns the items on page of T's table matching conds, with pageSize items per page,
+// and the total number of matching rows. Pages are numbered from 1 and ordered by primary key,
+// so consecutive pages neither overlap nor skip rows while the table is unchanged.
+//
+// Parameters:
+//
+//	ctx (context.Context): Context of the query. An ambient transaction from WithTransaction is joined.
+//	db (*PostgreSQL): Database to query.
+//	page (int): Page number, starting at 1.
+//	pageSize (int): Maximum number of items per page.
+//	conds (...interface{}): Conditions, in the forms accepted by Find.
+//
+// Returns:
+//
+//	items ([]T): Items on the page. Empty when page is past the last page.
+//	total (int64): Number of rows matching conds on all pages.
+//	err (error): An error if page or pageSize is not positive, or the query fails.
+//
+// Example:
+//
+//	db := database.New(...)
+//	orders, total, err := database.Page[Order](ctx, db, 1, 50, "status = ?", "open")
+//	if err != nil {
+//	    fmt.Println("Error paging orders:", err)
+//	}
+func Page[T any](ctx context.Context, db *PostgreSQL, page, pageSize int, conds ...interface{}) (items []T, total int64, err error) {
+	if page < 1 || pageSize < 1 {
+		return nil, 0, fmt.Errorf("failed to page; page %d and page size %d must be positive", page, pageSize)
+	}
+
+	query := db.Conn(ctx).Model(new(T))
+	if len(conds) > 0 {
+		query = query.Where(conds[0], conds[1:]...)
+	}
+	query = query.Session(&gorm.Session{})
+
+	order := query
+	stmt := &gorm.Statement{DB: db.DB}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, 0, fmt.Errorf("failed to page; %s", err.Error())
+	}
+	if pk := stmt.Schema.PrioritizedPrimaryField; pk != nil {
+		order = query.Order(clause.OrderByColumn{Column: clause.Column{Table: clause.CurrentTable, Name: pk.DBName}})
+	}
+
+	var rows []pageRow[T]
+	err = order.
+		Select("*, count(*) OVER() AS " + pageTotalColumn).
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Find(&rows).Error
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to page; %s", err.Error())
+	}
+
+	items = make([]T, len(rows))
+	for i, row := range rows {
+		items[i] = row.Item
+		// Hooks of T are not run by gorm, which scans into pageRow.
+		if hook, ok := interface{}(&items[i]).(callbacks.AfterFindInterface); ok {
+			if err := hook.AfterFind(query); err != nil {
+				return nil, 0, fmt.Errorf("failed to page; %s", err.Error())
+			}
+		}
+	}
+
+	if len(rows) > 0 {
+		return items, rows[0].Total, nil
+	}
+	if page == 1 {
+		return items, 0, nil
+	}
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to page; %s", err.Error())
+	}
+	return items, total, nil
+}
@@ -0,0 +1,79 @@
+/*
+Package database provides periodic connection pool logging for PostgreSQL connections.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+LogPoolStats is a lightweight alternative to a metrics backend: it writes the statistics of
+the primary connection pool to the logger at a fixed interval, so saturation is visible in
+the logs of environments without Prometheus or similar.
+
+Example usage:
+
+	db.DebugMode()
+	db.LogPoolStats(ctx, time.Minute)
+	// [info] pool stats: open=12 in_use=9 idle=3 wait_count=41 wait_duration=1.204s
+*/
+
+package database
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// LogPoolStats starts a background worker logging the statistics of the primary connection
+// pool at Info level every interval: open, in-use and idle connections, and the number of and
+// total time spent waiting for a connection. Messages are only written when the log level is
+// Info, e.g. after DebugMode.
+//
+// The worker stops when ctx is cancelled or the database is closed. At most one worker runs
+// at a time; calling LogPoolStats while one is running does nothing.
+//
+// Parameters:
+//
+//	ctx (context.Context): Context whose cancellation stops the worker.
+//	interval (time.Duration): Time between two log messages. Must be positive.
+//
+// Example:
+//
+//	db := database.New(...)
+//	db.LogPoolStats(ctx, 30*time.Second)
+func (db *PostgreSQL) LogPoolStats(ctx context.Context, interval time.Duration) {
+	if interval <= 0 || !atomic.CompareAndSwapInt32(&db.poolStatsRunning, 0, 1) {
+		return
+	}
+
+	go func() {
+		defer atomic.StoreInt32(&db.poolStatsRunning, 0)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-db.done:
+				return
+			case <-ticker.C:
+				db.logPoolStats(ctx)
+			}
+		}
+	}()
+}
+
+// logPoolStats writes the current statistics of the primary connection pool to the logger.
+func (db *PostgreSQL) logPoolStats(ctx context.Context) {
+	sqlDB, err := db.DB.DB()
+	if err != nil {
+		return
+	}
+
+	stats := sqlDB.Stats()
+	db.DB.Logger.Info(ctx, "pool stats: open=%d in_use=%d idle=%d wait_count=%d wait_duration=%s",
+		stats.OpenConnections, stats.InUse, stats.Idle, stats.WaitCount, stats.WaitDuration)
+}
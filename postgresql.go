@@ -10,9 +10,16 @@ Author: dexterdmonkey
 package database
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -22,6 +29,24 @@ import (
 type PostgreSQL struct {
 	*gorm.DB
 	*dbLogger
+
+	replicas  map[string]*sql.DB // replica pools keyed by "<group>/<index>"
+	lags      replicaLagCache    // replica lag measurements for ReadAfterWrite
+	metrics   Metrics            // receives measurements; nil records nothing
+	slowTx    time.Duration      // transactions taking longer are logged; <= 0 disables
+	done      chan struct{}      // closed by Close to stop background workers
+	closeOnce sync.Once
+
+	versionMu sync.Mutex
+	version   string // server version cached by ServerVersion
+
+	poolStatsRunning int32 // set while a LogPoolStats worker runs
+	healthRunning    int32 // set while a StartHealthLoop worker runs
+	healthy          int32 // 1 if the last ping of the health loop succeeded
+
+	generation       *uint64 // connection generation shared with the connectors, advanced by RecycleConnections
+	idleConns        int     // maximum idle connections of the primary pool, restored by RecycleConnections
+	replicaIdleConns int     // maximum idle connections of each replica pool
 }
 
 // CreatePostgreSQL initializes a new PostgreSQL database connection using the provided configuration.
@@ -30,30 +55,254 @@ func CreatePostgreSQL(cfg *Config) (*PostgreSQL, error) {
 		cfg.Timezone = "Asia/Jakarta"
 	}
 
-	gormDB, err := gorm.Open(postgres.New(postgres.Config{
-		DSN:                  cfg.DSN(),
-		PreferSimpleProtocol: true, // disables implicit prepared statement usage
-	}), &gorm.Config{})
+	if cfg.PrepareStmt && cfg.hasReplicas() {
+		return nil, errPrepareStmtWithReplicas
+	}
 
+	// DSN omits the password when the file cannot be read; report the cause instead.
+	if _, err := cfg.password(); err != nil {
+		return nil, fmt.Errorf("failed to read password file; %s", err.Error())
+	}
+
+	generation := new(uint64)
+	pool, err := openPool(cfg, cfg.DSN(), generation)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect database; %s", err.Error())
 	}
 
-	db := &PostgreSQL{DB: gormDB}
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: pool}), &gorm.Config{
+		PrepareStmt: cfg.PrepareStmt,
+	})
 
-	if cfg.MaxConnectionPool <= 0 {
-		if err := db.SetMaxConnectionPool(cfg.MaxConnectionPool); err != nil {
-			return nil, err
-		}
+	if err != nil {
+		// gorm leaves the pool open when its initial ping fails.
+		pool.Close()
+		return nil, categorizeConnectError(err)
 	}
 
-	if err := db.SetMinConnectionPool(cfg.MinConnectionPool); err != nil {
+	db := &PostgreSQL{DB: gormDB, done: make(chan struct{}), metrics: cfg.Metrics, slowTx: cfg.SlowTransactionThreshold, generation: generation}
+
+	// A failure past this point would otherwise leave the pools and workers started so far running.
+	if err := db.setup(cfg); err != nil {
+		db.Close()
 		return nil, err
 	}
 
 	return db, nil
 }
 
+// setup configures the pools and registers the callbacks and plugins selected by cfg on a
+// newly opened database.
+func (db *PostgreSQL) setup(cfg *Config) error {
+	gormDB := db.DB
+
+	if cfg.AutoPoolSize && cfg.MaxConnectionPool <= 0 {
+		cfg.MaxConnectionPool = autoPoolSize()
+	}
+
+	if err := db.SetMaxConnectionPool(cfg.MaxConnectionPool); err != nil {
+		return err
+	}
+
+	if err := db.SetMinConnectionPool(cfg.MinConnectionPool); err != nil {
+		return err
+	}
+
+	if err := registerReadOnlyGuard(gormDB); err != nil {
+		return fmt.Errorf("failed to register read-only guard; %s", err.Error())
+	}
+
+	if err := registerStatementLimit(gormDB); err != nil {
+		return fmt.Errorf("failed to register statement limit; %s", err.Error())
+	}
+
+	if err := registerByteCap(gormDB); err != nil {
+		return fmt.Errorf("failed to register byte cap; %s", err.Error())
+	}
+
+	if err := registerTags(gormDB); err != nil {
+		return fmt.Errorf("failed to register tags; %s", err.Error())
+	}
+
+	if m, ok := cfg.Metrics.(PreparedStatementMetrics); ok && cfg.PrepareStmt {
+		if err := registerStmtCacheMetrics(gormDB, m); err != nil {
+			return fmt.Errorf("failed to register prepared statement metrics; %s", err.Error())
+		}
+	}
+
+	if m, ok := cfg.Metrics.(QueryMetrics); ok {
+		if err := registerQueryMetrics(gormDB, m); err != nil {
+			return fmt.Errorf("failed to register query metrics; %s", err.Error())
+		}
+	}
+
+	if err := db.registerReplicas(cfg); err != nil {
+		return fmt.Errorf("failed to register replicas; %s", err.Error())
+	}
+
+	if cfg.TrackActor {
+		if err := registerActorTracking(gormDB, cfg.RequireActor); err != nil {
+			return fmt.Errorf("failed to register actor tracking; %s", err.Error())
+		}
+	}
+
+	if cfg.AuditDDL {
+		if err := registerDDLAudit(gormDB); err != nil {
+			return fmt.Errorf("failed to register ddl audit; %s", err.Error())
+		}
+	}
+
+	if cfg.GenerateUUID != nil {
+		if err := registerUUIDKeys(gormDB, cfg.GenerateUUID); err != nil {
+			return fmt.Errorf("failed to register uuid keys; %s", err.Error())
+		}
+	}
+
+	if !cfg.PrepareStmt && cfg.PrepareAdvisoryThreshold > 0 {
+		if err := registerPrepareAdvisory(gormDB, cfg.PrepareAdvisoryThreshold); err != nil {
+			return fmt.Errorf("failed to register prepare advisory; %s", err.Error())
+		}
+	}
+
+	if cfg.ExplainThreshold > 0 {
+		if err := registerExplain(gormDB, cfg.ExplainThreshold, newPlanSampler(cfg.ExplainSampleRate, cfg.ExplainSampleSeed)); err != nil {
+			return fmt.Errorf("failed to register explain; %s", err.Error())
+		}
+	}
+
+	// Registered before the acquire timeout, whose callbacks take the same positions, so
+	// rejected statements fail before waiting for a connection.
+	if cfg.MaxConcurrentQueries > 0 {
+		if err := registerAdmission(gormDB, cfg.MaxConcurrentQueries); err != nil {
+			return fmt.Errorf("failed to register admission limit; %s", err.Error())
+		}
+	}
+
+	if cfg.DefaultQueryTimeout > 0 {
+		if err := registerQueryTimeout(gormDB, cfg.DefaultQueryTimeout); err != nil {
+			return fmt.Errorf("failed to register query timeout; %s", err.Error())
+		}
+	}
+
+	if cfg.AcquireTimeout > 0 {
+		if err := registerAcquireTimeout(gormDB, cfg.AcquireTimeout); err != nil {
+			return fmt.Errorf("failed to register acquire timeout; %s", err.Error())
+		}
+	}
+
+	// The search_path set by the DSN already names the schema; it takes effect once created.
+	if cfg.CreateSchemaIfMissing && cfg.Schema != "" {
+		if err := db.DB.Exec("CREATE SCHEMA IF NOT EXISTS " + QuoteIdentifier(cfg.Schema)).Error; err != nil {
+			return fmt.Errorf("failed to create schema; %s", err.Error())
+		}
+	}
+
+	// Enabled last: the plugin's refresh workers cannot be stopped, so they are only started
+	// once nothing else can fail.
+	if cfg.EnablePrometheus {
+		if err := gormDB.Use(newPrometheus(cfg)); err != nil {
+			return fmt.Errorf("failed to enable prometheus; %s", err.Error())
+		}
+	}
+
+	if cfg.PrepareStmt && cfg.PreparedStmtTTL > 0 {
+		go db.clearPreparedStatementsEvery(cfg.PreparedStmtTTL)
+	}
+
+	return nil
+}
+
+// autoPoolSize returns the pool size used by Config.AutoPoolSize: runtime.NumCPU()*2 + 1,
+// following the common "cores * 2 + effective spindle count" formula with a single spindle,
+// which suits SSD-backed servers.
+func autoPoolSize() int {
+	return runtime.NumCPU()*2 + 1
+}
+
+// openPool opens the connection pool for dsn. The pool is opened here rather than by the
+// driver so connections can be wrapped, e.g. for Config.ReconnectSQLStates. Connections are
+// recycled when generation advances.
+func openPool(cfg *Config, dsn string, generation *uint64) (*sql.DB, error) {
+	connConfig, err := pgx.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := removeLibpqOnlyParams(connConfig.RuntimeParams); err != nil {
+		return nil, err
+	}
+
+	if !cfg.PrepareStmt {
+		connConfig.DefaultQueryExecMode = pgx.QueryExecModeSimpleProtocol // disables implicit prepared statement usage
+		if !cfg.isUTF8() || cfg.ExtendedProtocol {
+			// pgx only runs simple protocol queries with client_encoding=UTF8; Exec mode also
+			// avoids implicit prepared statements, sending arguments as bind parameters.
+			connConfig.DefaultQueryExecMode = pgx.QueryExecModeExec
+		}
+	}
+
+	var opts []stdlib.OptionOpenDB
+	if cfg.OnConnect != nil {
+		opts = append(opts, stdlib.OptionAfterConnect(cfg.OnConnect))
+	}
+	if cfg.AppNameTemplate != "" {
+		opts = append(opts, stdlib.OptionBeforeConnect(appNameHook(cfg.AppNameTemplate)))
+	}
+
+	// Connections are always wrapped: besides the configured hooks, the wrapper enforces
+	// byte caps set per session with WithByteCap.
+	connector := &reconnectConnector{
+		Connector:  stdlib.GetConnector(*connConfig, opts...),
+		sqlStates:  cfg.ReconnectSQLStates,
+		onClose:    cfg.OnDisconnect,
+		generation: generation,
+	}
+
+	return sql.OpenDB(connector), nil
+}
+
+// libpqOnlyParams are DSN options implemented by libpq but not by pgx, which would send them
+// to the server as run-time parameters and fail to connect.
+var libpqOnlyParams = []string{"gssencmode", "channel_binding"}
+
+// removeLibpqOnlyParams removes libpqOnlyParams from params. It fails when one of them is
+// "require", as pgx cannot provide the required protection and connecting without it
+// would silently weaken security.
+func removeLibpqOnlyParams(params map[string]string) error {
+	for _, key := range libpqOnlyParams {
+		value, ok := params[key]
+		if !ok {
+			continue
+		}
+		if value == "require" {
+			return fmt.Errorf("%s=require is not supported by the pgx driver", key)
+		}
+		delete(params, key)
+	}
+	return nil
+}
+
+// Close stops any background workers started by CreatePostgreSQL and closes the underlying
+// connection pools, including those of the replicas. It is safe to call Close more than once.
+func (db *PostgreSQL) Close() error {
+	db.closeOnce.Do(func() {
+		if db.done != nil {
+			close(db.done)
+		}
+	})
+
+	for _, replica := range db.replicas {
+		replica.Close()
+	}
+
+	sqlDB, err := db.DB.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get sql db; %s", err.Error())
+	}
+
+	return sqlDB.Close()
+}
+
 // SetMaxConnectionPool sets the maximum number of open connections to the database.
 // It configures the PostgreSQL database connection to allow up to 'n' concurrent open connections.
 //
@@ -107,19 +356,85 @@ func (db *PostgreSQL) SetMinConnectionPool(n int) error {
 	}
 
 	sqlDB.SetMaxIdleConns(n)
+	db.idleConns = n
 	return nil
 }
 
-// SetLogger sets a custom logger for the database.
-func (db *PostgreSQL) SetLogger(writer logger.Writer) {
+// ClearPreparedStatements closes and evicts every statement in the prepared statement cache.
+// Statements are prepared again on next use. It is a no-op when Config.PrepareStmt is disabled.
+// Config.PrepareStmt cannot be combined with replicas, whose statements dbresolver caches
+// separately, so the cache of the primary is the only one.
+//
+// Use it in long-running processes that build many distinct dynamic queries, where an
+// unbounded cache can exhaust server-side prepared statement memory.
+//
+// Example:
+//
+//	db := database.New(...)
+//	db.ClearPreparedStatements()
+func (db *PostgreSQL) ClearPreparedStatements() {
+	if stmtDB, ok := db.DB.ConnPool.(*gorm.PreparedStmtDB); ok {
+		stmtDB.Reset()
+	}
+}
+
+// RecycleConnections forces every pooled connection, of the primary and of the replicas, to be
+// replaced by a new one, e.g. after a failover or after rotating the database credentials,
+// without closing the pools. New connections are opened on demand.
+//
+// Idle connections are closed immediately, by dropping the maximum number of idle
+// connections to zero and restoring it. Connections in use, e.g. by a running query, an open
+// transaction or Listen, are not interrupted; each is closed instead of being reused when it
+// is returned to the pool. Connections opened after the call are unaffected.
+//
+// New connections use the DSN built by CreatePostgreSQL: a password changed in
+// Config.PassFile afterwards is not read again.
+//
+// Example:
+//
+//	db := database.New(...)
+//	db.RecycleConnections()
+func (db *PostgreSQL) RecycleConnections() {
+	if db.generation != nil {
+		atomic.AddUint64(db.generation, 1)
+	}
+
+	if sqlDB, err := db.DB.DB(); err == nil {
+		sqlDB.SetMaxIdleConns(0)
+		sqlDB.SetMaxIdleConns(db.idleConns)
+	}
+	for _, replica := range db.replicas {
+		replica.SetMaxIdleConns(0)
+		replica.SetMaxIdleConns(db.replicaIdleConns)
+	}
+}
+
+// clearPreparedStatementsEvery clears the prepared statement cache every interval until Close is called.
+func (db *PostgreSQL) clearPreparedStatementsEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-db.done:
+			return
+		case <-ticker.C:
+			db.ClearPreparedStatements()
+		}
+	}
+}
+
+// SetLogger sets a custom logger for the database. Options such as WithBindParams are passed to NewLogger.
+// "Record not found" errors are not logged unless WithRecordNotFoundErrors is given.
+func (db *PostgreSQL) SetLogger(writer logger.Writer, opts ...LoggerOption) {
 	config := logger.Config{
 		SlowThreshold:             200 * time.Millisecond,
 		Colorful:                  true,
-		IgnoreRecordNotFoundError: false,
+		IgnoreRecordNotFoundError: true,
 		LogLevel:                  logger.Warn,
 	}
 
-	db.dbLogger = NewLogger(writer, config)
+	db.dbLogger = NewLogger(writer, config, opts...)
 	db.Logger = db.dbLogger
 }
 
@@ -138,3 +453,95 @@ func (db *PostgreSQL) SetLogger(writer logger.Writer) {
 func (db *PostgreSQL) DebugMode() {
 	db.Logger = db.dbLogger.LogMode(logger.Info)
 }
+
+// WithoutSlowLog returns a session whose logger does not report slow queries, for known-heavy
+// operations such as batch jobs. Errors are still logged and the global logger is unchanged.
+// It has no effect unless the logger was set with SetLogger.
+//
+// Example:
+//
+//	db := database.New(...)
+//	err := db.WithoutSlowLog().Exec("REFRESH MATERIALIZED VIEW daily_totals").Error
+func (db *PostgreSQL) WithoutSlowLog() *gorm.DB {
+	l, ok := db.DB.Logger.(*dbLogger)
+	if !ok {
+		return db.DB.Session(&gorm.Session{})
+	}
+
+	quiet := *l
+	quiet.SlowThreshold = 0 // disables the slow query branch of Trace
+	return db.DB.Session(&gorm.Session{Logger: &quiet})
+}
+
+// WithDeadline returns a session whose statements are cancelled at t, and the function
+// releasing the deadline's context and timer. Call cancel once the session is no longer used,
+// typically with defer. A statement still running at the deadline is cancelled and its pool
+// slot is freed; the driver may close the interrupted connection, in which case the pool opens
+// a new one on demand.
+//
+// Returns:
+//
+//	*gorm.DB: Session bound to the deadline.
+//	context.CancelFunc: Releases the deadline; statements of the session still running are cancelled.
+//
+// Example:
+//
+//	db := database.New(...)
+//	conn, cancel := db.WithDeadline(time.Now().Add(2 * time.Second))
+//	defer cancel()
+//	err := conn.Find(&users).Error
+//	if errors.Is(err, context.DeadlineExceeded) {
+//	    fmt.Println("Query timed out")
+//	}
+func (db *PostgreSQL) WithDeadline(t time.Time) (*gorm.DB, context.CancelFunc) {
+	ctx, cancel := context.WithDeadline(context.Background(), t)
+	return db.DB.WithContext(ctx), cancel
+}
+
+// WithAssociations returns a session whose saves also upsert every loaded association, with
+// gorm's FullSaveAssociations, instead of only creating missing ones. Each associated record
+// costs additional INSERT ... ON CONFLICT DO UPDATE statements that rewrite all of its columns,
+// so use it only where the cascade is intended, and prefer saving associations explicitly in
+// hot paths.
+//
+// Example:
+//
+//	db := database.New(...)
+//	order.Items[0].Quantity = 3
+//	err := db.WithAssociations().Save(&order).Error // also updates order.Items
+func (db *PostgreSQL) WithAssociations() *gorm.DB {
+	return db.DB.Session(&gorm.Session{FullSaveAssociations: true})
+}
+
+// ServerVersion returns the server version reported by SHOW server_version, e.g.
+// "16.2 (Debian 16.2-1.pgdg120+2)". The version is fetched once and cached; a failed fetch is
+// retried on the next call.
+//
+// Example:
+//
+//	db := database.New(...)
+//	version, err := db.ServerVersion(ctx)
+//	if err != nil {
+//	    fmt.Println("Error reading server version:", err)
+//	}
+func (db *PostgreSQL) ServerVersion(ctx context.Context) (string, error) {
+	db.versionMu.Lock()
+	defer db.versionMu.Unlock()
+
+	if db.version != "" {
+		return db.version, nil
+	}
+
+	var version string
+	if err := db.DB.WithContext(ctx).Raw("SHOW server_version").Scan(&version).Error; err != nil {
+		return "", fmt.Errorf("failed to read server version; %s", err.Error())
+	}
+
+	db.version = version
+	return version, nil
+}
+
+// DriverName returns the name of the database/sql driver used for connections, "pgx".
+func (db *PostgreSQL) DriverName() string {
+	return "pgx"
+}
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithDeadline(t *testing.T) {
+	db, connector := newFakeDB(t)
+	connector.handle = func(ctx context.Context, query string) error {
+		if strings.Contains(query, "pg_sleep") {
+			// The driver returns once the statement is cancelled, as pgx does.
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	}
+
+	conn, cancel := db.WithDeadline(time.Now().Add(50 * time.Millisecond))
+	defer cancel()
+
+	err := conn.Exec("SELECT pg_sleep(10)").Error
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v; want context.DeadlineExceeded", err)
+	}
+
+	sqlDB, err := db.DB.DB()
+	if err != nil {
+		t.Fatalf("failed to get pool; %s", err.Error())
+	}
+	if inUse := sqlDB.Stats().InUse; inUse != 0 {
+		t.Errorf("%d connections in use after the deadline; want 0", inUse)
+	}
+}
+
+func TestWithDeadlineCancel(t *testing.T) {
+	db, _ := newFakeDB(t)
+
+	conn, cancel := db.WithDeadline(time.Now().Add(time.Hour))
+	if err := conn.Statement.Context.Err(); err != nil {
+		t.Fatalf("context done before cancel; %s", err.Error())
+	}
+
+	cancel()
+	if err := conn.Statement.Context.Err(); !errors.Is(err, context.Canceled) {
+		t.Errorf("context error after cancel = %v; want context.Canceled", err)
+	}
+}
+
+func TestCreatePostgreSQLClosesPoolOnFailure(t *testing.T) {
+	server := newFailoverServer(t, func(_ int, sql string) bool {
+		return strings.HasPrefix(sql, "CREATE SCHEMA")
+	})
+	server.nonFatal = true
+
+	cfg := &Config{
+		Host:                  "127.0.0.1",
+		Port:                  server.ln.Addr().(*net.TCPAddr).Port,
+		User:                  "app",
+		Name:                  "app",
+		Schema:                "reports",
+		CreateSchemaIfMissing: true,
+	}
+	if _, err := CreatePostgreSQL(cfg); err == nil || !strings.Contains(err.Error(), "failed to create schema") {
+		t.Fatalf("CreatePostgreSQL() = %v; want the schema creation to fail", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for server.open() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if open := server.open(); open != 0 {
+		t.Errorf("%d sessions left open after the failed constructor; want 0", open)
+	}
+}
+
+func TestSetupAdmitsBeforeAcquiring(t *testing.T) {
+	db, connector := newFakeDB(t)
+
+	running := make(chan struct{})
+	release := make(chan struct{})
+	connector.handle = func(context.Context, string) error {
+		running <- struct{}{}
+		<-release
+		return nil
+	}
+
+	cfg := &Config{MaxConnectionPool: 1, MaxConcurrentQueries: 1, AcquireTimeout: 5 * time.Second}
+	if err := db.setup(cfg); err != nil {
+		t.Fatalf("setup() = %v", err)
+	}
+
+	first := make(chan error, 1)
+	go func() { first <- db.Exec("SELECT 1").Error }()
+	<-running
+
+	// With the pool's only connection busy, the second statement must be rejected by the
+	// admission limit instead of waiting out the acquire timeout.
+	start := time.Now()
+	if err := db.Exec("SELECT 2").Error; !errors.Is(err, ErrTooBusy) {
+		t.Errorf("second statement = %v; want ErrTooBusy", err)
+	}
+	if waited := time.Since(start); waited > time.Second {
+		t.Errorf("second statement waited %s for a connection before being rejected", waited)
+	}
+
+	close(release)
+	if err := <-first; err != nil {
+		t.Errorf("first statement = %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Package database provides Prometheus metrics through the gorm Prometheus plugin.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+With Config.EnablePrometheus, CreatePostgreSQL installs gorm.io/plugin/prometheus configured
+from Config.Prometheus. Connection pool statistics are exported as gorm_dbstats_* gauges on
+the default Prometheus registry. Setting PrometheusConfig.MetricsPrefix also exports server
+status metrics, such as replication lag, table statistics and database size, under that prefix.
+
+Example usage:
+
+	cfg.EnablePrometheus = true
+	cfg.Prometheus = database.PrometheusConfig{
+	    RefreshInterval: 30 * time.Second,
+	    MetricsPrefix:   "orders_db_",
+	    Labels:          map[string]string{"service": "orders"},
+	}
+	db, err := database.CreatePostgreSQL(cfg)
+
+	http.Handle("/metrics", promhttp.Handler())
+
+Notes:
+  - Metrics are refreshed by background workers of the plugin, which run until the process exits.
+*/
+
+package database
+
+import (
+	"math"
+	"time"
+
+	gormprometheus "gorm.io/plugin/prometheus"
+)
+
+// PrometheusConfig configures the gorm Prometheus plugin enabled with Config.EnablePrometheus.
+type PrometheusConfig struct {
+	DBName          string            // Value of the db_name label of every metric. Default is Config.Name.
+	RefreshInterval time.Duration     // Interval at which metrics are refreshed, rounded up to whole seconds. Default is 15s.
+	MetricsPrefix   string            // Prefix of server status metrics, e.g. "orders_db_". Set to "" to export pool statistics only. Default is "".
+	Labels          map[string]string // Constant labels added to every metric. Default is none.
+	StartServer     bool              // Serve the default registry at /metrics on HTTPServerPort. Default is false.
+	HTTPServerPort  uint32            // Port of the metrics server started with StartServer. Default is 8080.
+	PushAddr        string            // Address of a Pushgateway that metrics are pushed to. Default is "", pushing nothing.
+}
+
+// newPrometheus returns the gorm Prometheus plugin configured by cfg.Prometheus.
+func newPrometheus(cfg *Config) *gormprometheus.Prometheus {
+	p := cfg.Prometheus
+
+	dbName := p.DBName
+	if dbName == "" {
+		dbName = cfg.Name
+	}
+
+	var refreshInterval uint32
+	if p.RefreshInterval > 0 {
+		refreshInterval = uint32(math.Ceil(p.RefreshInterval.Seconds()))
+	}
+
+	var collectors []gormprometheus.MetricsCollector
+	if p.MetricsPrefix != "" {
+		collectors = append(collectors, &gormprometheus.Postgres{Prefix: p.MetricsPrefix})
+	}
+
+	// Labels is copied: the plugin adds db_name to the map it is given.
+	labels := make(map[string]string, len(p.Labels))
+	for k, v := range p.Labels {
+		labels[k] = v
+	}
+
+	return gormprometheus.New(gormprometheus.Config{
+		DBName:           dbName,
+		RefreshInterval:  refreshInterval,
+		StartServer:      p.StartServer,
+		HTTPServerPort:   p.HTTPServerPort,
+		PushAddr:         p.PushAddr,
+		MetricsCollector: collectors,
+		Labels:           labels,
+	})
+}
@@ -0,0 +1,67 @@
+/*
+Package database provides read-only sessions that reject writes.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+ReadOnly returns a session for code paths that must never mutate data. Queries built from it
+are routed to the read replicas when replicas are configured, and creates, updates and
+deletes fail with ErrReadOnly before any SQL is sent.
+
+Example usage:
+
+	func listUsers(db *database.PostgreSQL) ([]User, error) {
+	    var users []User
+	    err := db.ReadOnly().Find(&users).Error
+	    return users, err
+	}
+*/
+
+package database
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// ErrReadOnly is returned for creates, updates and deletes on a session returned by ReadOnly.
+var ErrReadOnly = errors.New("write attempted on read-only session")
+
+// readOnlySetting is the statement setting marking a session as read-only.
+const readOnlySetting = "database:read_only"
+
+// ReadOnly returns a session that routes queries to the read replicas, if configured, and
+// rejects creates, updates and deletes with ErrReadOnly. Raw statements run with Exec are
+// not inspected. The session can be reused; conditions added to one statement do not carry
+// over to the next.
+//
+// Example:
+//
+//	db := database.New(...)
+//	err := db.ReadOnly().Delete(&user).Error // errors.Is(err, database.ErrReadOnly)
+func (db *PostgreSQL) ReadOnly() *gorm.DB {
+	return db.DB.Clauses(dbresolver.Read).Set(readOnlySetting, true).Session(&gorm.Session{})
+}
+
+// registerReadOnlyGuard registers callbacks rejecting writes on read-only sessions.
+func registerReadOnlyGuard(gormDB *gorm.DB) error {
+	cb := gormDB.Callback()
+	if err := cb.Create().Before("gorm:begin_transaction").Register("database:read_only", rejectReadOnlyWrite); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:begin_transaction").Register("database:read_only", rejectReadOnlyWrite); err != nil {
+		return err
+	}
+	return cb.Delete().Before("gorm:begin_transaction").Register("database:read_only", rejectReadOnlyWrite)
+}
+
+// rejectReadOnlyWrite fails the statement when it was built from a read-only session.
+func rejectReadOnlyWrite(tx *gorm.DB) {
+	if readOnly, ok := tx.Get(readOnlySetting); ok && readOnly == true {
+		tx.AddError(ErrReadOnly)
+	}
+}
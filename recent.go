@@ -0,0 +1,114 @@
+/*
+Package database provides a bounded history of the most recent statements.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+When a test fails intermittently, the log rarely shows what the code under test actually
+sent to the database. With the WithRecentQueries logger option, the logger keeps the last N
+traced statements, with their duration, row count and error, in a fixed-size ring buffer,
+and RecentQueries returns them oldest first so a failing test can dump them.
+
+The history is disabled by default. When enabled, it holds at most N records, whatever the
+number of statements run, and records every statement regardless of the log level.
+
+Example usage:
+
+	db.SetLogger(os.Stdout, database.WithRecentQueries(50))
+
+	t.Cleanup(func() {
+	    if t.Failed() {
+	        for _, q := range db.RecentQueries() {
+	            t.Logf("%s [%v] %s (err: %v)", q.Time.Format(time.RFC3339Nano), q.Duration, q.SQL, q.Err)
+	        }
+	    }
+	})
+
+Notes:
+  - The SQL is recorded with its arguments interpolated, unless logger.Config.ParameterizedQueries
+    is enabled, so do not enable the history where arguments may hold secrets.
+  - Recording is serialized and builds the SQL of every statement; it is meant for tests and
+    debugging, not for production.
+*/
+
+package database
+
+import (
+	"sync"
+	"time"
+)
+
+// QueryRecord is a statement kept by WithRecentQueries.
+type QueryRecord struct {
+	Time     time.Time     // When the statement started.
+	SQL      string        // Statement as the logger traces it, with its arguments.
+	Rows     int64         // Rows affected or returned, or -1 if unknown.
+	Duration time.Duration // Time taken by the statement.
+	Err      error         // Error of the statement, or nil.
+}
+
+// queryHistory is a ring buffer of the most recent statements.
+type queryHistory struct {
+	mu      sync.Mutex
+	records []QueryRecord
+	next    int  // index the next record is written to
+	full    bool // set once records has wrapped around
+}
+
+// WithRecentQueries keeps the last n traced statements, returned by RecentQueries. It is
+// disabled when n is not positive.
+func WithRecentQueries(n int) LoggerOption {
+	return func(l *dbLogger) {
+		if n <= 0 {
+			l.recent = nil
+			return
+		}
+		l.recent = &queryHistory{records: make([]QueryRecord, n)}
+	}
+}
+
+// add records a statement, overwriting the oldest one once the buffer is full.
+func (h *queryHistory) add(record QueryRecord) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.records[h.next] = record
+	h.next++
+	if h.next == len(h.records) {
+		h.next = 0
+		h.full = true
+	}
+}
+
+// snapshot returns a copy of the recorded statements, oldest first.
+func (h *queryHistory) snapshot() []QueryRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.full {
+		return append([]QueryRecord(nil), h.records[:h.next]...)
+	}
+	records := make([]QueryRecord, 0, len(h.records))
+	records = append(records, h.records[h.next:]...)
+	return append(records, h.records[:h.next]...)
+}
+
+// RecentQueries returns the statements kept by the WithRecentQueries logger option, oldest
+// first. It returns nil unless the logger was set with SetLogger and that option.
+//
+// Example:
+//
+//	db := database.New(...)
+//	db.SetLogger(os.Stdout, database.WithRecentQueries(20))
+//	// ...
+//	for _, q := range db.RecentQueries() {
+//	    fmt.Println(q.Duration, q.SQL, q.Err)
+//	}
+func (db *PostgreSQL) RecentQueries() []QueryRecord {
+	if db.dbLogger == nil || db.dbLogger.recent == nil {
+		return nil
+	}
+	return db.dbLogger.recent.snapshot()
+}
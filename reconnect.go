@@ -0,0 +1,221 @@
+/*
+Package database provides reconnect-on-error handling for failover scenarios.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+After a failover the server terminates existing sessions, e.g. with admin_shutdown (57P01),
+and the pooled connection that receives the error is dead. When the error's SQLSTATE is
+listed in Config.ReconnectSQLStates, the connection is reported to database/sql as bad: it
+is discarded instead of being returned to the pool, and database/sql retries the statement.
+It retries up to twice on pooled connections, which may be stale as well, and then once on a
+newly opened connection, so a statement runs at most three times. These retries are made by
+database/sql and are not drawn from a budget set with WithRetryBudget.
+
+A stale pooled connection whose server went away can also fail at the network level, e.g.
+with an unexpected EOF, on the first statement sent after a failover. RetryOnConnError runs
+a single query again on another connection after such a connection-level error; SQL errors
+are returned as is.
+
+Example usage:
+
+	cfg.ReconnectSQLStates = database.FailoverSQLStates
+	db, _ := database.CreatePostgreSQL(cfg)
+
+	var user User
+	err := db.RetryOnConnError(ctx, func(conn *gorm.DB) error {
+	    return conn.First(&user, id).Error
+	})
+
+Notes:
+  - Only errors raised while starting a statement outside of a transaction are retried;
+    a statement failing inside a transaction fails the transaction.
+  - List only SQLSTATEs that guarantee the statement did not run, such as the 57P class.
+*/
+
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/gorm"
+)
+
+// FailoverSQLStates lists the SQLSTATEs the server reports to sessions it terminates during
+// a shutdown or failover: admin_shutdown, crash_shutdown and cannot_connect_now.
+var FailoverSQLStates = []string{"57P01", "57P02", "57P03"}
+
+// reconnectConnector wraps a pgx connector so connections report listed SQLSTATEs as bad
+// connections. It also carries the Config.OnDisconnect hook, WithByteCap enforcement and
+// RecycleConnections, which need the same wrapping.
+type reconnectConnector struct {
+	driver.Connector
+	sqlStates  []string
+	onClose    DisconnectFunc
+	generation *uint64 // current connection generation; nil never recycles
+}
+
+// Connect opens a connection that reports the connector's SQLSTATEs as bad connections.
+func (c *reconnectConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stdConn, ok := conn.(*stdlib.Conn)
+	if !ok {
+		return conn, nil
+	}
+	rc := &reconnectConn{Conn: stdConn, sqlStates: c.sqlStates, onClose: c.onClose, generation: c.generation}
+	if c.generation != nil {
+		rc.born = atomic.LoadUint64(c.generation)
+	}
+	return rc, nil
+}
+
+// reconnectConn is a pgx connection that reports listed SQLSTATEs as bad connections.
+type reconnectConn struct {
+	*stdlib.Conn
+	sqlStates  []string
+	onClose    DisconnectFunc
+	generation *uint64
+	born       uint64 // generation the connection was opened in
+}
+
+// IsValid reports whether the connection may be returned to the pool: it must be open and
+// not opened before the last RecycleConnections.
+func (c *reconnectConn) IsValid() bool {
+	if c.generation != nil && atomic.LoadUint64(c.generation) != c.born {
+		return false
+	}
+	return !c.Conn.Conn().IsClosed()
+}
+
+// Close runs the OnDisconnect hook, if any, and closes the connection.
+func (c *reconnectConn) Close() error {
+	if c.onClose != nil {
+		c.onClose(c.Conn.Conn())
+	}
+	return c.Conn.Close()
+}
+
+// BeginTx starts a transaction, reporting listed SQLSTATEs as a bad connection.
+func (c *reconnectConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	tx, err := c.Conn.BeginTx(ctx, opts)
+	return tx, c.badConn(err)
+}
+
+// ExecContext executes a statement, reporting listed SQLSTATEs as a bad connection.
+func (c *reconnectConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	result, err := c.Conn.ExecContext(ctx, query, args)
+	return result, c.badConn(err)
+}
+
+// QueryContext executes a query, reporting listed SQLSTATEs as a bad connection. The rows
+// enforce the byte cap carried by ctx, if any.
+func (c *reconnectConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rows, err := c.Conn.QueryContext(ctx, query, args)
+	if err != nil {
+		return nil, c.badConn(err)
+	}
+	return capRows(ctx, rows), nil
+}
+
+// Ping verifies the connection, reporting listed SQLSTATEs as a bad connection.
+func (c *reconnectConn) Ping(ctx context.Context) error {
+	return c.badConn(c.Conn.Ping(ctx))
+}
+
+// badConn wraps err as a bad connection error when its SQLSTATE is listed.
+func (c *reconnectConn) badConn(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+
+	for _, code := range c.sqlStates {
+		if pgErr.Code == code {
+			return badConnError{err: err}
+		}
+	}
+	return err
+}
+
+// badConnError reports a connection as bad to database/sql while keeping the original error.
+type badConnError struct {
+	err error
+}
+
+func (e badConnError) Error() string { return e.err.Error() }
+
+func (e badConnError) Unwrap() error { return e.err }
+
+func (e badConnError) Is(target error) bool { return target == driver.ErrBadConn }
+
+// RetryOnConnError runs fn with a session bound to ctx and, if it fails with a connection-level
+// error such as a reset or an unexpected EOF, runs it exactly once more. The driver closes a
+// connection after such an error and the pool never hands it out again, so the retry runs on
+// another connection. SQL errors reported by the server and context errors are not retried.
+//
+// fn may run twice and must be safe to repeat: the first attempt may have executed on the
+// server before the connection failed. Inside a transaction stored in ctx by WithTransaction,
+// fn runs once on the transaction, since a failed connection aborts the whole transaction.
+// The retry counts against the budget set with WithRetryBudget; once the budget is spent, the
+// error of the first attempt is returned.
+//
+// Parameters:
+//
+//	ctx (context.Context): Context bound to the session passed to fn.
+//	fn (func(conn *gorm.DB) error): Issues a single query on conn.
+//
+// Returns:
+//
+//	error: The error of the last attempt.
+//
+// Example:
+//
+//	db := database.New(...)
+//	var count int64
+//	err := db.RetryOnConnError(ctx, func(conn *gorm.DB) error {
+//	    return conn.Model(&User{}).Count(&count).Error
+//	})
+func (db *PostgreSQL) RetryOnConnError(ctx context.Context, fn func(conn *gorm.DB) error) error {
+	if tx, ok := transactionFromContext(ctx); ok {
+		return fn(tx.WithContext(ctx))
+	}
+
+	err := fn(db.DB.WithContext(ctx))
+	if !isConnError(err) || ctx.Err() != nil || !takeRetry(ctx) {
+		return err
+	}
+	return fn(db.DB.WithContext(ctx))
+}
+
+// isConnError reports whether err is a connection-level failure rather than an error reported
+// by the server or caused by the context.
+func isConnError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return false
+	}
+
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.As(err, &netErr) ||
+		pgconn.SafeToRetry(err)
+}
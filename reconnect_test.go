@@ -0,0 +1,205 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+	"gorm.io/gorm"
+)
+
+func TestRetryOnConnError(t *testing.T) {
+	db, _ := newFakeDB(t)
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		err       error
+		wantCalls int
+		wantLeft  int // retries left in the budget of ctx, if any
+	}{
+		{"connection error", context.Background(), io.ErrUnexpectedEOF, 2, 0},
+		{"connection error within budget", WithRetryBudget(context.Background(), 2), io.ErrUnexpectedEOF, 2, 1},
+		{"connection error with spent budget", WithRetryBudget(context.Background(), 0), io.ErrUnexpectedEOF, 1, 0},
+		{"SQL error", WithRetryBudget(context.Background(), 2), &pgconn.PgError{Code: "23505"}, 1, 2},
+		{"cancelled context", cancelled, io.ErrUnexpectedEOF, 1, 0},
+		{"success", context.Background(), nil, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			err := db.RetryOnConnError(tt.ctx, func(conn *gorm.DB) error {
+				calls++
+				return tt.err
+			})
+			if !errors.Is(err, tt.err) {
+				t.Errorf("err = %v; want %v", err, tt.err)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("fn ran %d times; want %d", calls, tt.wantCalls)
+			}
+			if left, ok := RetryBudget(tt.ctx); ok && left != tt.wantLeft {
+				t.Errorf("%d retries left; want %d", left, tt.wantLeft)
+			}
+		})
+	}
+}
+
+// failoverServer is a PostgreSQL server on a local port that answers simple queries. It
+// terminates the session of every failing query with admin_shutdown, as a server does during
+// a failover, or with nonFatal set, reports insufficient_privilege and keeps the session.
+type failoverServer struct {
+	ln       net.Listener
+	nonFatal bool
+
+	mu       sync.Mutex
+	queries  int
+	sessions int                          // sessions currently open
+	failing  func(n int, sql string) bool // reports whether the n-th query, from 1, fails
+}
+
+// newFailoverServer starts a failoverServer, stopped when the test ends.
+func newFailoverServer(t *testing.T, failing func(n int, sql string) bool) *failoverServer {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen; %s", err.Error())
+	}
+	s := &failoverServer{ln: ln, failing: failing}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// dsn returns the DSN of the server.
+func (s *failoverServer) dsn() string {
+	addr := s.ln.Addr().(*net.TCPAddr)
+	return fmt.Sprintf("host=127.0.0.1 port=%d user=app dbname=app sslmode=disable", addr.Port)
+}
+
+// received returns the number of queries received.
+func (s *failoverServer) received() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queries
+}
+
+// open returns the number of sessions currently open.
+func (s *failoverServer) open() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sessions
+}
+
+// serve runs a session on conn.
+func (s *failoverServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	s.mu.Lock()
+	s.sessions++
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.sessions--
+		s.mu.Unlock()
+	}()
+
+	backend := pgproto3.NewBackend(conn, conn)
+	if _, err := backend.ReceiveStartupMessage(); err != nil {
+		return
+	}
+	backend.Send(&pgproto3.AuthenticationOk{})
+	backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+	if err := backend.Flush(); err != nil {
+		return
+	}
+
+	for {
+		msg, err := backend.Receive()
+		if err != nil {
+			return
+		}
+		query, ok := msg.(*pgproto3.Query)
+		if !ok {
+			return
+		}
+
+		s.mu.Lock()
+		s.queries++
+		fail := s.failing(s.queries, query.String)
+		s.mu.Unlock()
+
+		if fail && s.nonFatal {
+			backend.Send(&pgproto3.ErrorResponse{Severity: "ERROR", Code: "42501", Message: "permission denied"})
+			backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+			if err := backend.Flush(); err != nil {
+				return
+			}
+			continue
+		}
+		if fail {
+			backend.Send(&pgproto3.ErrorResponse{Severity: "FATAL", Code: "57P01", Message: "terminating connection due to administrator command"})
+			backend.Flush()
+			return
+		}
+		backend.Send(&pgproto3.CommandComplete{CommandTag: []byte("SELECT 1")})
+		backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+		if err := backend.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func TestReconnectSQLStatesAttempts(t *testing.T) {
+	tests := []struct {
+		name      string
+		sqlStates []string
+		failing   func(n int, sql string) bool
+		wantRuns  int
+		wantErr   bool
+	}{
+		{"not listed", nil, func(int, string) bool { return true }, 1, true},
+		{"listed, retry succeeds", FailoverSQLStates, func(n int, _ string) bool { return n == 1 }, 2, false},
+		{"listed, every attempt fails", FailoverSQLStates, func(int, string) bool { return true }, 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFailoverServer(t, tt.failing)
+			pool, err := openPool(&Config{ReconnectSQLStates: tt.sqlStates}, server.dsn(), nil)
+			if err != nil {
+				t.Fatalf("failed to open pool; %s", err.Error())
+			}
+			defer pool.Close()
+
+			_, err = pool.ExecContext(context.Background(), "SELECT 1")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v; want error %v", err, tt.wantErr)
+			}
+			var pgErr *pgconn.PgError
+			if tt.wantErr && (!errors.As(err, &pgErr) || pgErr.Code != "57P01") {
+				t.Errorf("err = %v; want admin_shutdown", err)
+			}
+			if runs := server.received(); runs != tt.wantRuns {
+				t.Errorf("statement ran %d times; want %d", runs, tt.wantRuns)
+			}
+		})
+	}
+}
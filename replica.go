@@ -0,0 +1,352 @@
+/*
+Package database provides read replica routing for PostgreSQL connections using GORM's
+dbresolver plugin.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+Replicas listed in Config.ReplicaDSNs serve reads for every query, load-balanced at random,
+while writes go to the primary. Config.NamedReplicas registers additional replica groups
+that only serve queries pinned to them with Source, e.g. routing heavy analytics to a
+dedicated replica while normal reads keep balancing across the shared ones.
+
+Example usage:
+
+	cfg.ReplicaDSNs = []string{"host=replica-1 ...", "host=replica-2 ..."}
+	cfg.NamedReplicas = map[string][]string{
+	    "analytics": {"host=analytics-replica ..."},
+	}
+	db, _ := database.CreatePostgreSQL(cfg)
+
+	db.Find(&users)                                   // replica-1 or replica-2
+	db.Source("analytics").Raw(reportSQL).Scan(&rows) // analytics-replica
+
+Reads issued right after a write may not see it on a lagging replica. ReadAfterWrite returns
+a session on a replica of Config.ReplicaDSNs whose replay lag is within a bound, falling back
+to the primary when none is. Lag is measured with one query per replica and cached for
+ReplicaLagCacheTTL, so frequent calls do not add a round trip each.
+
+	db.Create(&order)
+	db.ReadAfterWrite(ctx, 100*time.Millisecond).First(&order, order.ID)
+
+A request that has written can instead mark its context with ForcePrimary, so every read
+issued with that context goes to the primary without per-call routing.
+
+	ctx = database.ForcePrimary(ctx)
+	db.Conn(ctx).Create(&order)
+	db.Conn(ctx).First(&order, order.ID) // primary
+*/
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// defaultReplicaGroup names the replicas of Config.ReplicaDSNs in CheckReplicas results.
+const defaultReplicaGroup = "default"
+
+// ReplicaLagCacheTTL is how long ReadAfterWrite reuses a replica's measured lag.
+const ReplicaLagCacheTTL = time.Second
+
+// ReplicaLagProbeTimeout bounds each lag measurement of a replica by ReadAfterWrite. A replica
+// that does not answer in time is treated as ineligible.
+var ReplicaLagProbeTimeout = 500 * time.Millisecond
+
+// replicaLagQuery returns the replay lag of a replica in seconds: zero when it has replayed
+// all WAL it received, otherwise the age of the last replayed transaction. It returns NULL
+// on a server that is not in recovery.
+const replicaLagQuery = `SELECT CASE
+	WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())
+END`
+
+// replicaLag is a cached lag measurement of a replica.
+type replicaLag struct {
+	lag        time.Duration
+	err        error
+	measuredAt time.Time
+}
+
+// replicaLagCache holds the latest lag measurement of each replica.
+type replicaLagCache struct {
+	mu       sync.Mutex
+	samples  map[string]replicaLag
+	inflight map[string]*lagProbe // measurements in progress, shared by concurrent callers
+}
+
+// lagProbe is a lag measurement in progress. done is closed once sample is set.
+type lagProbe struct {
+	done   chan struct{}
+	sample replicaLag
+}
+
+// registerReplicas registers the replicas configured in cfg with the dbresolver plugin.
+func (db *PostgreSQL) registerReplicas(cfg *Config) error {
+	if !cfg.hasReplicas() {
+		return nil
+	}
+
+	db.replicas = make(map[string]*sql.DB)
+	resolver := &dbresolver.DBResolver{}
+	if len(cfg.ReplicaDSNs) > 0 {
+		replicas, err := db.openReplicas(cfg, defaultReplicaGroup, cfg.ReplicaDSNs)
+		if err != nil {
+			return err
+		}
+		resolver.Register(dbresolver.Config{Replicas: replicas})
+
+		// Each replica is also registered on its own so ReadAfterWrite can pin a query to it.
+		for i, replica := range replicas {
+			resolver.Register(dbresolver.Config{Replicas: []gorm.Dialector{replica}}, replicaName(defaultReplicaGroup, i))
+		}
+	}
+	for name, dsns := range cfg.NamedReplicas {
+		if len(dsns) == 0 {
+			return fmt.Errorf("failed to register replica %s; no dsn given", name)
+		}
+		replicas, err := db.openReplicas(cfg, name, dsns)
+		if err != nil {
+			return fmt.Errorf("failed to register replica %s; %s", name, err.Error())
+		}
+		resolver.Register(dbresolver.Config{Replicas: replicas}, name)
+	}
+
+	if err := db.DB.Use(resolver); err != nil {
+		return err
+	}
+	if err := registerForcePrimary(db.DB); err != nil {
+		return err
+	}
+
+	resolver.SetMaxOpenConns(cfg.MaxConnectionPool)
+	resolver.SetMaxIdleConns(cfg.MinConnectionPool)
+	db.replicaIdleConns = cfg.MinConnectionPool
+	return nil
+}
+
+// openReplicas opens a pool for each replica DSN of group and returns their dialectors.
+func (db *PostgreSQL) openReplicas(cfg *Config, group string, dsns []string) ([]gorm.Dialector, error) {
+	dialectors := make([]gorm.Dialector, len(dsns))
+	for i, dsn := range dsns {
+		pool, err := openPool(cfg, dsn, db.generation)
+		if err != nil {
+			return nil, err
+		}
+		db.replicas[replicaName(group, i)] = pool
+		dialectors[i] = postgres.New(postgres.Config{Conn: pool})
+	}
+	return dialectors, nil
+}
+
+// forcePrimaryKey is the context key marking contexts created by ForcePrimary.
+type forcePrimaryKey struct{}
+
+// ForcePrimary returns a copy of ctx whose statements are all routed to the primary,
+// including reads that would otherwise go to a replica, giving read-your-writes consistency
+// for the rest of a request.
+func ForcePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forcePrimaryKey{}, true)
+}
+
+// registerForcePrimary registers callbacks routing reads to the primary for contexts created
+// by ForcePrimary. Like the dbresolver callbacks they run before every other callback, and
+// since callbacks registered later with Before("*") are sorted first, they must be
+// registered after the resolver plugin.
+func registerForcePrimary(gormDB *gorm.DB) error {
+	cb := gormDB.Callback()
+	if err := cb.Query().Before("*").Register("database:force_primary", routeToPrimary); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("*").Register("database:force_primary", routeToPrimary); err != nil {
+		return err
+	}
+	return cb.Raw().Before("*").Register("database:force_primary", routeToPrimary)
+}
+
+// routeToPrimary marks the statement as a write for dbresolver when its context was created by ForcePrimary.
+func routeToPrimary(tx *gorm.DB) {
+	if force, _ := tx.Statement.Context.Value(forcePrimaryKey{}).(bool); force {
+		dbresolver.Write.ModifyStatement(tx.Statement)
+	}
+}
+
+// replicaName returns the key of the replica at index i of group, e.g. "default/0".
+func replicaName(group string, i int) string {
+	return fmt.Sprintf("%s/%d", group, i)
+}
+
+// CheckReplicas pings every registered replica concurrently and returns the result per
+// replica, keyed by "<group>/<index>": "default/0" for the first entry of
+// Config.ReplicaDSNs, "analytics/1" for the second replica of the "analytics" group in
+// Config.NamedReplicas. A nil error means the replica is reachable. Pinging also warms the
+// replica's pool with a connection.
+//
+// Example:
+//
+//	db := database.New(...)
+//	for replica, err := range db.CheckReplicas(ctx) {
+//	    if err != nil {
+//	        fmt.Println("Replica unhealthy:", replica, err)
+//	    }
+//	}
+func (db *PostgreSQL) CheckReplicas(ctx context.Context) map[string]error {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]error, len(db.replicas))
+	)
+
+	for name, pool := range db.replicas {
+		wg.Add(1)
+		go func(name string, pool *sql.DB) {
+			defer wg.Done()
+
+			err := pool.PingContext(ctx)
+			if err != nil {
+				err = fmt.Errorf("failed to ping replica %s; %s", name, err.Error())
+			}
+
+			mu.Lock()
+			results[name] = err
+			mu.Unlock()
+		}(name, pool)
+	}
+
+	wg.Wait()
+	return results
+}
+
+// Source returns a session pinned to the replica group registered under name in
+// Config.NamedReplicas. Reads run on the group's replicas; writes still go to the primary.
+//
+// The name shares its namespace with table names: queries against a table with the same
+// name are routed to the group as well.
+//
+// Example:
+//
+//	db := database.New(...)
+//	var totals []Total
+//	err := db.Source("analytics").Raw("SELECT ...").Scan(&totals).Error
+func (db *PostgreSQL) Source(name string) *gorm.DB {
+	return db.DB.Clauses(dbresolver.Use(name)).Session(&gorm.Session{})
+}
+
+// ReadAfterWrite returns a session whose reads run on a replica of Config.ReplicaDSNs lagging
+// at most maxLag behind the primary, picked at random among the eligible ones. When no
+// replica qualifies, or none is configured, the session reads from the primary. Writes always
+// go to the primary.
+//
+// Lag is measured on demand and cached for ReplicaLagCacheTTL; a replica that fails to report
+// its lag is treated as ineligible until the next measurement.
+//
+// Example:
+//
+//	db := database.New(...)
+//	db.Create(&user)
+//	err := db.ReadAfterWrite(ctx, 50*time.Millisecond).First(&user, user.ID).Error
+func (db *PostgreSQL) ReadAfterWrite(ctx context.Context, maxLag time.Duration) *gorm.DB {
+	var eligible []string
+	for name, sample := range db.replicaLags(ctx) {
+		if sample.err == nil && sample.lag <= maxLag {
+			eligible = append(eligible, name)
+		}
+	}
+
+	if len(eligible) == 0 {
+		return db.DB.WithContext(ctx).Clauses(dbresolver.Write).Session(&gorm.Session{})
+	}
+	return db.DB.WithContext(ctx).Clauses(dbresolver.Use(eligible[rand.Intn(len(eligible))])).Session(&gorm.Session{})
+}
+
+// replicaLags returns the lag of every replica of Config.ReplicaDSNs, measuring concurrently
+// those whose cached sample is older than ReplicaLagCacheTTL. Concurrent callers share the
+// measurement of a replica in progress rather than starting their own. A caller whose ctx is
+// done before a measurement completes gets an error sample for that replica.
+func (db *PostgreSQL) replicaLags(ctx context.Context) map[string]replicaLag {
+	results := make(map[string]replicaLag)
+	probes := make(map[string]*lagProbe)
+
+	// The lock only guards the cache; measurements run without it.
+	db.lags.mu.Lock()
+	if db.lags.samples == nil {
+		db.lags.samples = make(map[string]replicaLag)
+		db.lags.inflight = make(map[string]*lagProbe)
+	}
+	for i := 0; ; i++ {
+		name := replicaName(defaultReplicaGroup, i)
+		pool, ok := db.replicas[name]
+		if !ok {
+			break
+		}
+		if sample, cached := db.lags.samples[name]; cached && time.Since(sample.measuredAt) < ReplicaLagCacheTTL {
+			results[name] = sample
+			continue
+		}
+
+		probe, running := db.lags.inflight[name]
+		if !running {
+			probe = &lagProbe{done: make(chan struct{})}
+			db.lags.inflight[name] = probe
+			go db.probeReplicaLag(name, pool, probe)
+		}
+		probes[name] = probe
+	}
+	db.lags.mu.Unlock()
+
+	for name, probe := range probes {
+		select {
+		case <-probe.done:
+			results[name] = probe.sample
+		case <-ctx.Done():
+			results[name] = replicaLag{err: fmt.Errorf("failed to measure replica lag; %s", ctx.Err().Error())}
+		}
+	}
+	return results
+}
+
+// probeReplicaLag measures the lag of the replica behind pool within ReplicaLagProbeTimeout,
+// caches it under name and completes probe. The measurement is shared by every caller waiting
+// on probe, so it does not depend on the context of any one of them.
+func (db *PostgreSQL) probeReplicaLag(name string, pool *sql.DB, probe *lagProbe) {
+	ctx, cancel := context.WithTimeout(context.Background(), ReplicaLagProbeTimeout)
+	sample := measureReplicaLag(ctx, pool)
+	cancel()
+
+	db.lags.mu.Lock()
+	db.lags.samples[name] = sample
+	delete(db.lags.inflight, name)
+	db.lags.mu.Unlock()
+
+	probe.sample = sample
+	close(probe.done)
+}
+
+// measureReplicaLag queries the replay lag of the replica behind pool.
+func measureReplicaLag(ctx context.Context, pool *sql.DB) replicaLag {
+	sample := replicaLag{measuredAt: time.Now()}
+
+	var seconds sql.NullFloat64
+	if err := pool.QueryRowContext(ctx, replicaLagQuery).Scan(&seconds); err != nil {
+		sample.err = fmt.Errorf("failed to measure replica lag; %s", err.Error())
+		return sample
+	}
+	if !seconds.Valid {
+		sample.err = fmt.Errorf("failed to measure replica lag; server is not in recovery")
+		return sample
+	}
+
+	sample.lag = time.Duration(seconds.Float64 * float64(time.Second))
+	return sample
+}
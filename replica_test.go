@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newFakeReplicas registers n replicas of Config.ReplicaDSNs backed by fake connectors on db.
+func newFakeReplicas(t *testing.T, db *PostgreSQL, n int, handle func(ctx context.Context, query string) error) []*fakeConnector {
+	t.Helper()
+
+	db.replicas = make(map[string]*sql.DB)
+	connectors := make([]*fakeConnector, n)
+	for i := range connectors {
+		connectors[i] = &fakeConnector{handle: handle}
+		pool := sql.OpenDB(connectors[i])
+		t.Cleanup(func() { pool.Close() })
+		db.replicas[replicaName(defaultReplicaGroup, i)] = pool
+	}
+	return connectors
+}
+
+func TestReplicaLagsShareMeasurements(t *testing.T) {
+	db, _ := newFakeDB(t)
+	release := make(chan struct{})
+	connectors := newFakeReplicas(t, db, 2, func(ctx context.Context, query string) error {
+		<-release
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if lags := db.replicaLags(context.Background()); len(lags) != 2 {
+				t.Errorf("got %d samples; want 2", len(lags))
+			}
+		}()
+	}
+
+	// While the measurements run, the cache is not locked.
+	for _, connector := range connectors {
+		for len(connector.sent()) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if !db.lags.mu.TryLock() {
+		t.Fatal("lag cache locked during measurement")
+	}
+	db.lags.mu.Unlock()
+
+	close(release)
+	wg.Wait()
+
+	for i, connector := range connectors {
+		if sent := connector.sent(); len(sent) != 1 {
+			t.Errorf("replica %d measured %d times; want 1", i, len(sent))
+		}
+	}
+}
+
+func TestReplicaLagsTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { ReplicaLagProbeTimeout = timeout }(ReplicaLagProbeTimeout)
+	ReplicaLagProbeTimeout = 20 * time.Millisecond
+
+	db, _ := newFakeDB(t)
+	newFakeReplicas(t, db, 1, func(ctx context.Context, query string) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	begin := time.Now()
+	lags := db.replicaLags(context.Background())
+	if elapsed := time.Since(begin); elapsed > time.Second {
+		t.Errorf("measurement took %v; want it bounded by ReplicaLagProbeTimeout", elapsed)
+	}
+	if sample := lags[replicaName(defaultReplicaGroup, 0)]; sample.err == nil {
+		t.Error("unresponsive replica reported no error")
+	}
+}
+
+func TestReplicaLagsCallerContext(t *testing.T) {
+	db, _ := newFakeDB(t)
+	release := make(chan struct{})
+	defer close(release)
+	newFakeReplicas(t, db, 1, func(ctx context.Context, query string) error {
+		<-release
+		return nil
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if sample := db.replicaLags(ctx)[replicaName(defaultReplicaGroup, 0)]; sample.err == nil {
+		t.Error("replica reported no error after the caller's deadline")
+	}
+}
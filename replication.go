@@ -0,0 +1,492 @@
+/*
+Package database provides change data capture with logical replication.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+StartReplication opens a replication connection, streams the changes of a publication from
+a logical replication slot with the built-in pgoutput plugin, and delivers each inserted,
+updated and deleted row as a Change, e.g. to invalidate caches. Column values are delivered
+in their text representation, as they would be printed by psql.
+
+The slot remembers how far its consumer got. The stream acknowledges a transaction once all
+of its changes have been received from the channel, so after a restart streaming resumes
+with the first transaction not acknowledged yet. Changes of an interrupted transaction may
+thus be delivered again; consumers must tolerate duplicates.
+
+Setup, once per database:
+
+	-- postgresql.conf: wal_level = logical
+	CREATE PUBLICATION cache_invalidation FOR TABLE users, orders;
+	SELECT pg_create_logical_replication_slot('cache_invalidation', 'pgoutput');
+
+The database user needs the REPLICATION attribute.
+
+Example usage:
+
+	changes, err := db.StartReplication(ctx, "cache_invalidation", "cache_invalidation")
+	if err != nil {
+	    return err
+	}
+	for c := range changes {
+	    if c.Kind == database.ReplicationFailed {
+	        log.Println("replication stopped:", c.Err)
+	        break
+	    }
+	    if id := c.Values["id"]; id != nil {
+	        cache.Delete(c.Table + ":" + *id)
+	    } else if id := c.OldValues["id"]; id != nil {
+	        cache.Delete(c.Table + ":" + *id)
+	    }
+	}
+
+Notes:
+  - A slot retains WAL on the server until its changes are acknowledged; drop slots that are
+    no longer consumed with pg_drop_replication_slot, or the disk fills up.
+  - The consumer must keep up: while a change waits to be received, the stream sends no
+    status updates and the server ends it after wal_sender_timeout.
+  - Unchanged TOASTed values, i.e. large values not modified by an update, are not sent by
+    the server and are missing from Change.Values.
+  - Truncations, logical decoding messages and other events are not delivered.
+*/
+
+package database
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// ReplicationStatusInterval is the time between two status updates of a replication stream,
+// which acknowledge the changes received so far and keep the connection alive. It must be
+// shorter than the server's wal_sender_timeout.
+var ReplicationStatusInterval = 10 * time.Second
+
+// ChangeKind is the kind of a change delivered by StartReplication.
+type ChangeKind int
+
+// Kinds of changes delivered by StartReplication.
+const (
+	Inserted          ChangeKind = iota // A row was inserted.
+	Updated                             // A row was updated.
+	Deleted                             // A row was deleted.
+	ReplicationFailed                   // The stream failed; the channel is closed afterwards.
+)
+
+// Change is a row change delivered by StartReplication. Values are the text representation of
+// the columns, nil for NULL.
+type Change struct {
+	Kind      ChangeKind         // Kind of change.
+	Schema    string             // Schema of the changed table.
+	Table     string             // Name of the changed table.
+	Values    map[string]*string // New row of inserts and updates. Nil for deletes.
+	OldValues map[string]*string // Old row of deletes, and of updates changing the key: only the key columns, or every column with REPLICA IDENTITY FULL. Nil otherwise.
+	LSN       uint64             // WAL position of the change.
+	Err       error              // Error that ended the stream, for ReplicationFailed.
+}
+
+// postgresEpoch is the origin of the timestamps of the replication protocol.
+var postgresEpoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// StartReplication streams the changes of publication from the logical replication slot slot
+// and delivers them on the returned channel, in commit order. The slot must exist and use the
+// pgoutput plugin. The stream runs on a dedicated replication connection with the settings of
+// the primary pool; when it fails, a ReplicationFailed change is delivered. The returned
+// channel is closed once the stream fails, ctx is done or Close is called.
+//
+// Changes are delivered unbuffered; see the package notes on keeping up.
+//
+// Parameters:
+//
+//	ctx (context.Context): Context bounding the lifetime of the stream.
+//	slot (string): Name of the logical replication slot.
+//	publication (string): Name of the publication whose tables are streamed.
+//
+// Returns:
+//
+//	<-chan Change: Row changes, and a final ReplicationFailed change if the stream fails.
+//	error: An error if the replication connection or START_REPLICATION fails.
+//
+// Example:
+//
+//	db := database.New(...)
+//	changes, err := db.StartReplication(ctx, "orders_cdc", "orders_pub")
+//	if err != nil {
+//	    fmt.Println("Error starting replication:", err)
+//	}
+//	for c := range changes {
+//	    fmt.Println(c.Kind, c.Table, c.Values)
+//	}
+func (db *PostgreSQL) StartReplication(ctx context.Context, slot, publication string) (<-chan Change, error) {
+	conn, err := db.replicationConn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start replication; %s", err.Error())
+	}
+
+	if err := startReplication(ctx, conn, slot, publication); err != nil {
+		conn.Close(context.Background())
+		return nil, fmt.Errorf("failed to start replication from slot %s; %s", slot, err.Error())
+	}
+
+	s := &replicationStream{conn: conn, changes: make(chan Change), relations: make(map[uint32]replicationRelation)}
+
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-db.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	go func() {
+		defer cancel()
+		s.run(ctx)
+	}()
+	return s.changes, nil
+}
+
+// replicationConn opens a replication connection with the settings of the primary pool.
+func (db *PostgreSQL) replicationConn(ctx context.Context) (*pgconn.PgConn, error) {
+	sqlDB, err := db.DB.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var config *pgconn.Config
+	err = conn.Raw(func(driverConn interface{}) error {
+		c, ok := driverConn.(interface{ Conn() *pgx.Conn })
+		if !ok {
+			return fmt.Errorf("unsupported driver connection %T", driverConn)
+		}
+		config = c.Conn().Config().Config.Copy()
+		return nil
+	})
+	conn.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.RuntimeParams == nil {
+		config.RuntimeParams = make(map[string]string)
+	}
+	config.RuntimeParams["replication"] = "database"
+	return pgconn.ConnectConfig(ctx, config)
+}
+
+// startReplication sends START_REPLICATION and waits for the server to start streaming.
+func startReplication(ctx context.Context, conn *pgconn.PgConn, slot, publication string) error {
+	query := fmt.Sprintf("START_REPLICATION SLOT %s LOGICAL 0/0 (proto_version '1', publication_names %s)",
+		QuoteIdentifier(slot), quoteLiteral(QuoteIdentifier(publication)))
+
+	conn.Frontend().Send(&pgproto3.Query{String: query})
+	if err := conn.Frontend().Flush(); err != nil {
+		return err
+	}
+
+	for {
+		msg, err := conn.ReceiveMessage(ctx)
+		if err != nil {
+			return err
+		}
+		switch msg := msg.(type) {
+		case *pgproto3.CopyBothResponse:
+			return nil
+		case *pgproto3.ErrorResponse:
+			return pgconn.ErrorResponseToPgError(msg)
+		}
+	}
+}
+
+// replicationRelation is a table described by a pgoutput relation message.
+type replicationRelation struct {
+	schema  string
+	table   string
+	columns []string
+}
+
+// replicationStream decodes the changes streamed on a replication connection for StartReplication.
+type replicationStream struct {
+	conn      *pgconn.PgConn
+	changes   chan Change
+	relations map[uint32]replicationRelation
+	acked     uint64 // end of the last transaction whose changes were all delivered
+}
+
+// run delivers the streamed changes until the stream fails or ctx is done, then acknowledges
+// the delivered transactions one last time and closes the connection.
+func (s *replicationStream) run(ctx context.Context) {
+	defer close(s.changes)
+
+	err := s.receive(ctx)
+	if !s.conn.IsClosed() {
+		s.sendStatus()
+	}
+	closeCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	s.conn.Close(closeCtx)
+	cancel()
+
+	if ctx.Err() == nil {
+		s.send(ctx, Change{Kind: ReplicationFailed, Err: err})
+	}
+}
+
+// receive decodes the messages of the stream, sending a status update every
+// ReplicationStatusInterval, until the stream fails or ctx is done.
+func (s *replicationStream) receive(ctx context.Context) error {
+	nextStatus := time.Now().Add(ReplicationStatusInterval)
+	for {
+		if !time.Now().Before(nextStatus) {
+			if err := s.sendStatus(); err != nil {
+				return err
+			}
+			nextStatus = time.Now().Add(ReplicationStatusInterval)
+		}
+
+		receiveCtx, cancel := context.WithDeadline(ctx, nextStatus)
+		msg, err := s.conn.ReceiveMessage(receiveCtx)
+		cancel()
+		if err != nil {
+			if pgconn.Timeout(err) && ctx.Err() == nil {
+				continue
+			}
+			return err
+		}
+
+		switch msg := msg.(type) {
+		case *pgproto3.ErrorResponse:
+			return pgconn.ErrorResponseToPgError(msg)
+		case *pgproto3.CopyData:
+			if err := s.handle(ctx, msg.Data); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// handle processes a keepalive or a WAL data message of the stream.
+func (s *replicationStream) handle(ctx context.Context, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	switch data[0] {
+	case 'k': // primary keepalive: WAL end, server time, reply requested
+		if len(data) >= 18 && data[17] == 1 {
+			return s.sendStatus()
+		}
+	case 'w': // WAL data: WAL start, WAL end, server time, pgoutput message
+		if len(data) < 25 {
+			return fmt.Errorf("malformed WAL data message")
+		}
+		return s.decode(ctx, binary.BigEndian.Uint64(data[1:9]), data[25:])
+	}
+	return nil
+}
+
+// decode delivers the change of the pgoutput message msg, found at WAL position lsn.
+func (s *replicationStream) decode(ctx context.Context, lsn uint64, msg []byte) error {
+	r := &pgoutputReader{buf: msg}
+	change := Change{LSN: lsn}
+
+	var rel replicationRelation
+	var err error
+	switch r.byte() {
+	case 'C': // commit: flags, commit LSN, end LSN, commit time
+		r.byte()
+		r.uint64()
+		end := r.uint64()
+		if r.err == nil {
+			// Every change of the transaction has been delivered.
+			s.acked = end
+		}
+		return r.err
+	case 'R': // relation: ID, namespace, name, replica identity, columns
+		id := r.uint32()
+		described := replicationRelation{schema: r.cstring(), table: r.cstring()}
+		r.byte()
+		n := int(r.uint16())
+		for i := 0; i < n && r.err == nil; i++ {
+			r.byte() // flags
+			described.columns = append(described.columns, r.cstring())
+			r.uint32() // type OID
+			r.uint32() // type modifier
+		}
+		if r.err == nil {
+			s.relations[id] = described
+		}
+		return r.err
+	case 'I': // insert: relation ID, 'N', new tuple
+		change.Kind = Inserted
+		if rel, err = s.relation(r); err != nil {
+			return err
+		}
+		r.byte()
+		change.Values = r.tuple(rel)
+	case 'U': // update: relation ID, optional 'K' or 'O' and old tuple, 'N', new tuple
+		change.Kind = Updated
+		if rel, err = s.relation(r); err != nil {
+			return err
+		}
+		if kind := r.byte(); kind == 'K' || kind == 'O' {
+			change.OldValues = r.tuple(rel)
+			r.byte()
+		}
+		change.Values = r.tuple(rel)
+	case 'D': // delete: relation ID, 'K' or 'O', old tuple
+		change.Kind = Deleted
+		if rel, err = s.relation(r); err != nil {
+			return err
+		}
+		r.byte()
+		change.OldValues = r.tuple(rel)
+	default: // begin, origin, type, truncate and logical decoding messages
+		return nil
+	}
+
+	if r.err != nil {
+		return r.err
+	}
+	change.Schema, change.Table = rel.schema, rel.table
+	s.send(ctx, change)
+	return nil
+}
+
+// relation reads a relation ID and returns the relation it refers to.
+func (s *replicationStream) relation(r *pgoutputReader) (replicationRelation, error) {
+	id := r.uint32()
+	if r.err != nil {
+		return replicationRelation{}, r.err
+	}
+
+	rel, ok := s.relations[id]
+	if !ok {
+		return replicationRelation{}, fmt.Errorf("change of unknown relation %d", id)
+	}
+	return rel, nil
+}
+
+// sendStatus acknowledges the delivered transactions to the server.
+func (s *replicationStream) sendStatus() error {
+	buf := make([]byte, 34)
+	buf[0] = 'r'
+	binary.BigEndian.PutUint64(buf[1:], s.acked)  // written
+	binary.BigEndian.PutUint64(buf[9:], s.acked)  // flushed
+	binary.BigEndian.PutUint64(buf[17:], s.acked) // applied
+	binary.BigEndian.PutUint64(buf[25:], uint64(time.Since(postgresEpoch).Microseconds()))
+
+	s.conn.Frontend().Send(&pgproto3.CopyData{Data: buf})
+	return s.conn.Frontend().Flush()
+}
+
+// send delivers c unless ctx is done first. It reports whether c was delivered.
+func (s *replicationStream) send(ctx context.Context, c Change) bool {
+	select {
+	case s.changes <- c:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// pgoutputReader reads the fields of a pgoutput message. After the first error, reads return
+// zero values and err holds the error.
+type pgoutputReader struct {
+	buf []byte
+	err error
+}
+
+// next returns the next n bytes of the message.
+func (r *pgoutputReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.buf) {
+		r.err = fmt.Errorf("malformed pgoutput message")
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+// byte reads a byte.
+func (r *pgoutputReader) byte() byte {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+// uint16 reads a big-endian 16-bit integer.
+func (r *pgoutputReader) uint16() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+// uint32 reads a big-endian 32-bit integer.
+func (r *pgoutputReader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+// uint64 reads a big-endian 64-bit integer.
+func (r *pgoutputReader) uint64() uint64 {
+	if b := r.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+// cstring reads a NUL-terminated string.
+func (r *pgoutputReader) cstring() string {
+	for i, c := range r.buf {
+		if c == 0 {
+			return string(r.next(i + 1)[:i])
+		}
+	}
+	if r.err == nil {
+		r.err = fmt.Errorf("malformed pgoutput message")
+	}
+	return ""
+}
+
+// tuple reads the column values of a row of rel. Unchanged TOASTed values are left out.
+func (r *pgoutputReader) tuple(rel replicationRelation) map[string]*string {
+	n := int(r.uint16())
+	if r.err == nil && n > len(rel.columns) {
+		r.err = fmt.Errorf("row of %s.%s has %d columns, want at most %d", rel.schema, rel.table, n, len(rel.columns))
+	}
+
+	values := make(map[string]*string, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		switch kind := r.byte(); kind {
+		case 'n':
+			values[rel.columns[i]] = nil
+		case 'u':
+		case 't', 'b':
+			v := string(r.next(int(r.uint32())))
+			values[rel.columns[i]] = &v
+		default:
+			if r.err == nil {
+				r.err = fmt.Errorf("unknown column value kind %q", kind)
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,93 @@
+/*
+Package database provides retry budgets for PostgreSQL connections.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+Retries help with transient failures but amplify load during an incident, when every layer
+retries at once. A retry budget stored in the context with WithRetryBudget is shared by all
+retrying helpers of this package, WithTransaction with TxRetries and RetryOnConnError, so one
+request retries at most a fixed number of times in total, however many operations it nests.
+Once the budget is spent, retries stop and the underlying error is returned.
+
+Example usage:
+
+	ctx = database.WithRetryBudget(r.Context(), 3)
+
+	// Both transactions draw from the same three retries.
+	err := db.WithTransaction(ctx, reserveStock, database.TxRetries(5))
+	err = db.WithTransaction(ctx, chargeCustomer, database.TxRetries(5))
+*/
+
+package database
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// RetryableSQLStates lists the SQLSTATEs after which a transaction can be retried as a
+// whole: serialization_failure and deadlock_detected.
+var RetryableSQLStates = []string{"40001", "40P01"}
+
+// retryBudgetKey is the context key under which the retry budget is stored.
+type retryBudgetKey struct{}
+
+// retryBudget is the number of retries left to the operations sharing a context.
+type retryBudget struct {
+	remaining int64
+}
+
+// WithRetryBudget returns a context allowing at most retries retries in total among the
+// retrying helpers it is passed to, including nested operations.
+func WithRetryBudget(ctx context.Context, retries int) context.Context {
+	return context.WithValue(ctx, retryBudgetKey{}, &retryBudget{remaining: int64(retries)})
+}
+
+// RetryBudget returns the number of retries left in the budget of ctx, and whether ctx
+// carries a budget at all.
+func RetryBudget(ctx context.Context) (int, bool) {
+	budget, ok := ctx.Value(retryBudgetKey{}).(*retryBudget)
+	if !ok {
+		return 0, false
+	}
+	return int(atomic.LoadInt64(&budget.remaining)), true
+}
+
+// takeRetry takes one retry from the budget of ctx. It reports false when the budget is
+// spent; a context without a budget always allows the retry.
+func takeRetry(ctx context.Context) bool {
+	budget, ok := ctx.Value(retryBudgetKey{}).(*retryBudget)
+	if !ok {
+		return true
+	}
+	for {
+		remaining := atomic.LoadInt64(&budget.remaining)
+		if remaining <= 0 {
+			return false
+		}
+		if atomic.CompareAndSwapInt64(&budget.remaining, remaining, remaining-1) {
+			return true
+		}
+	}
+}
+
+// isRetryable reports whether err carries one of RetryableSQLStates.
+func isRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+
+	for _, code := range RetryableSQLStates {
+		if pgErr.Code == code {
+			return true
+		}
+	}
+	return false
+}
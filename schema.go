@@ -0,0 +1,75 @@
+/*
+Package database provides per-transaction schema selection for schema-based multi-tenancy.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+With one schema per tenant, each request must resolve unqualified table names in its
+tenant's schema. Setting search_path on a pooled connection would leak the tenant to the
+next request using the connection, so WithSchema sets it with SET LOCAL semantics inside the
+ambient transaction: it reverts when the transaction ends and never outlives the request.
+
+Example usage:
+
+	err := db.WithTransaction(ctx, func(ctx context.Context) error {
+	    tenantDB := db.WithSchema(ctx, "tenant_" + tenantID)
+	    return tenantDB.Find(&invoices).Error // reads "tenant_42".invoices
+	})
+*/
+
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// WithSchema sets the search_path of the transaction stored in ctx to schema and returns a
+// session on that transaction. The schema name is quoted, so it is matched exactly, e.g.
+// case-sensitively, and cannot inject SQL. The setting lasts until the transaction ends and
+// applies to every statement of the transaction, including those not issued through the
+// returned session.
+//
+// WithSchema must be called inside WithTransaction; otherwise the session fails with
+// ErrNoTransaction, as a session-wide search_path would leak into other requests sharing
+// the pooled connection.
+//
+// Parameters:
+//
+//	ctx (context.Context): Context carrying the transaction from WithTransaction.
+//	schema (string): Name of the schema to resolve unqualified names in.
+//
+// Returns:
+//
+//	*gorm.DB: Session on the transaction. Its Error is set if the schema cannot be set.
+//
+// Example:
+//
+//	db := database.New(...)
+//	err := db.WithTransaction(ctx, func(ctx context.Context) error {
+//	    return db.WithSchema(ctx, "tenant_42").Create(&invoice).Error
+//	})
+func (db *PostgreSQL) WithSchema(ctx context.Context, schema string) *gorm.DB {
+	tx, ok := transactionFromContext(ctx)
+	if !ok {
+		conn := db.DB.WithContext(ctx)
+		conn.AddError(fmt.Errorf("%w; search_path can only be set inside WithTransaction", ErrNoTransaction))
+		return conn
+	}
+
+	conn := tx.WithContext(ctx)
+	if schema == "" {
+		conn.AddError(fmt.Errorf("failed to set schema; schema name is empty"))
+		return conn
+	}
+
+	// is_local = true reverts the setting when the transaction ends.
+	if err := conn.Exec("SELECT set_config('search_path', ?, true)", QuoteIdentifier(schema)).Error; err != nil {
+		conn.AddError(fmt.Errorf("failed to set schema; %s", err.Error()))
+	}
+	return conn
+}
@@ -0,0 +1,69 @@
+package database
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestScopesRejectInvalidArguments(t *testing.T) {
+	tests := []struct {
+		name  string
+		scope func(*gorm.DB) *gorm.DB
+		want  error
+	}{
+		{"injected column", OrderBy("id; DROP TABLE x", "asc"), ErrInvalidColumn},
+		{"three-part column", OrderBy("a.b.c", "asc"), ErrInvalidColumn},
+		{"quoted column", OrderBy(`"id"`, "asc"), ErrInvalidColumn},
+		{"empty column", OrderBy("", "asc"), ErrInvalidColumn},
+		{"bad direction", OrderBy("id", "desc; DROP TABLE x"), ErrInvalidDirection},
+		{"where in column", WhereIn("id; DROP TABLE x", []int{1}), ErrInvalidColumn},
+		{"between column", Between("a.b.c", 1, 2), ErrInvalidColumn},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, connector := newFakeDB(t)
+
+			var rows []testCounter
+			if err := db.Scopes(tt.scope).Find(&rows).Error; !errors.Is(err, tt.want) {
+				t.Errorf("Find() = %v; want %v", err, tt.want)
+			}
+			if sent := connector.sent(); len(sent) != 0 {
+				t.Errorf("sent %q; want no statements", sent)
+			}
+		})
+	}
+}
+
+func TestScopesSQL(t *testing.T) {
+	tests := []struct {
+		name  string
+		scope func(*gorm.DB) *gorm.DB
+		want  string
+	}{
+		{"order by", OrderBy("name", ""), `ORDER BY "name"`},
+		{"order by qualified", OrderBy("test_counters.hits", "DESC"), `ORDER BY "test_counters"."hits" DESC`},
+		{"where in", WhereIn("id", []int{1, 2}), `WHERE "id" IN ($1,$2)`},
+		{"where in empty", WhereIn("id", []int{}), `WHERE "id" IN (NULL)`},
+		{"between", Between("hits", 10, 100), `WHERE "hits" BETWEEN $1 AND $2`},
+		{"compose", Compose(OrderBy("id", "asc"), Limit(5)), `ORDER BY "id" LIMIT $1`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newDryRunDB(t)
+
+			var rows []testCounter
+			stmt := db.Scopes(tt.scope).Find(&rows)
+			if stmt.Error != nil {
+				t.Fatalf("Find() = %v", stmt.Error)
+			}
+			if got := stmt.Statement.SQL.String(); !strings.Contains(got, tt.want) {
+				t.Errorf("SQL = %q; want it to contain %q", got, tt.want)
+			}
+		})
+	}
+}
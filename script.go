@@ -0,0 +1,126 @@
+/*
+Package database provides execution of multi-statement SQL scripts.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+ExecScript splits a script into its statements and executes them one by one, as the
+extended protocol accepts a single statement per Exec. Semicolons inside string literals,
+quoted identifiers, comments, including nested block comments, and dollar-quoted bodies,
+e.g. of functions, do not end a statement.
+
+Example usage:
+
+	err := db.ExecScript(ctx, `
+	    CREATE TABLE counters (name text PRIMARY KEY, hits bigint NOT NULL DEFAULT 0);
+	    CREATE FUNCTION touch(n text) RETURNS void AS $$
+	    BEGIN
+	        INSERT INTO counters VALUES (n, 1) ON CONFLICT (name) DO UPDATE SET hits = counters.hits + 1;
+	    END;
+	    $$ LANGUAGE plpgsql;
+	    INSERT INTO counters (name) VALUES ('seed');
+	`)
+*/
+
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ExecScript executes the statements of script in order within a single transaction, so a
+// failing statement leaves none of them applied. An ambient transaction from
+// WithTransaction is joined.
+//
+// Parameters:
+//
+//	ctx (context.Context): Context bounding the script.
+//	script (string): SQL statements separated by semicolons.
+//
+// Returns:
+//
+//	error: An error naming the failing statement if one fails.
+//
+// Example:
+//
+//	db := database.New(...)
+//	seed, _ := os.ReadFile("testdata/seed.sql")
+//	if err := db.ExecScript(ctx, string(seed)); err != nil {
+//	    fmt.Println("Error seeding database:", err)
+//	}
+func (db *PostgreSQL) ExecScript(ctx context.Context, script string) error {
+	statements := splitStatements(script)
+	if len(statements) == 0 {
+		return nil
+	}
+
+	return db.WithTransaction(ctx, func(ctx context.Context) error {
+		for i, statement := range statements {
+			if err := db.Conn(ctx).Exec(statement).Error; err != nil {
+				return fmt.Errorf("failed to execute statement %d of script; %s", i+1, err.Error())
+			}
+		}
+		return nil
+	})
+}
+
+// splitStatements splits script at the semicolons ending its statements, dropping statements
+// holding nothing but whitespace and comments.
+func splitStatements(script string) []string {
+	var statements []string
+	start, empty := 0, true
+
+	flush := func(end int) {
+		if !empty {
+			statements = append(statements, strings.TrimSpace(script[start:end]))
+		}
+		start, empty = end+1, true
+	}
+
+	for i := 0; i < len(script); {
+		c := script[i]
+		switch {
+		case c == ';':
+			flush(i)
+			i++
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.HasPrefix(script[i:], "--"):
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				end = len(script) - i
+			}
+			i += end
+		case strings.HasPrefix(script[i:], "/*"):
+			i = skipBlockComment(script, i)
+		case c == '\'':
+			i, empty = skipQuoted(script, i, false), false
+		case (c == 'e' || c == 'E') && i+1 < len(script) && script[i+1] == '\'' && !endsWithWord(script[:i]):
+			i, empty = skipQuoted(script, i+1, true), false
+		case c == '"':
+			next := len(script)
+			if end := strings.IndexByte(script[i+1:], '"'); end >= 0 {
+				next = i + end + 2
+			}
+			i, empty = next, false
+		default:
+			empty = false
+			if tag, ok := dollarQuoteTag(script[i:]); ok && c == '$' && !endsWithWord(script[:i]) {
+				if end := strings.Index(script[i+len(tag):], tag); end >= 0 {
+					i += len(tag) + end + len(tag)
+				} else {
+					i = len(script)
+				}
+				continue
+			}
+			i++
+		}
+	}
+	flush(len(script))
+
+	return statements
+}
@@ -0,0 +1,46 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{"single", "SELECT 1", []string{"SELECT 1"}},
+		{"several", "SELECT 1; SELECT 2;\nSELECT 3", []string{"SELECT 1", "SELECT 2", "SELECT 3"}},
+		{"empty statements", " ;;\n; SELECT 1;; ", []string{"SELECT 1"}},
+		{"only comments", "-- nothing;\n/* here; */", nil},
+		{"string literal", "SELECT 'a;b'; SELECT 2", []string{"SELECT 'a;b'", "SELECT 2"}},
+		{"doubled quote", "SELECT 'it''s;'; SELECT 2", []string{"SELECT 'it''s;'", "SELECT 2"}},
+		{"E-string", `SELECT E'\';'; SELECT 2`, []string{`SELECT E'\';'`, "SELECT 2"}},
+		{"quoted identifier", `SELECT "a;b" FROM t; SELECT 2`, []string{`SELECT "a;b" FROM t`, "SELECT 2"}},
+		{"line comment", "SELECT 1 -- one; two\n; SELECT 2", []string{"SELECT 1 -- one; two", "SELECT 2"}},
+		{"block comment", "SELECT /* ; */ 1; SELECT 2", []string{"SELECT /* ; */ 1", "SELECT 2"}},
+		{"nested block comment", "/* a /* nested; */ still comment; */ SELECT 1; SELECT 2", []string{"/* a /* nested; */ still comment; */ SELECT 1", "SELECT 2"}},
+		{
+			"dollar-quoted body",
+			"CREATE FUNCTION f() RETURNS void AS $$ BEGIN PERFORM 1; END; $$ LANGUAGE plpgsql; SELECT 2",
+			[]string{"CREATE FUNCTION f() RETURNS void AS $$ BEGIN PERFORM 1; END; $$ LANGUAGE plpgsql", "SELECT 2"},
+		},
+		{
+			"tagged dollar quote",
+			"DO $body$ BEGIN RAISE NOTICE '$$;'; END $body$; SELECT 2",
+			[]string{"DO $body$ BEGIN RAISE NOTICE '$$;'; END $body$", "SELECT 2"},
+		},
+		{"parameters", "SELECT $1, $2; SELECT $1", []string{"SELECT $1, $2", "SELECT $1"}},
+		{"parameter before dollar quote", "SELECT $1 || $$;$$; SELECT 2", []string{"SELECT $1 || $$;$$", "SELECT 2"}},
+		{"dollar in identifier", "SELECT a$b; SELECT 2", []string{"SELECT a$b", "SELECT 2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitStatements(tt.script); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitStatements(%q) = %q; want %q", tt.script, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestSharedSessionsAreReusable(t *testing.T) {
+	db := newDryRunDB(t)
+	if err := registerTags(db.DB); err != nil {
+		t.Fatalf("failed to register tags; %s", err.Error())
+	}
+
+	tests := []struct {
+		name    string
+		session *gorm.DB
+		want    string
+	}{
+		{"ReadOnly", db.ReadOnly(), `SELECT * FROM "test_counters" WHERE id = $1 AND name = $2`},
+		{"Tag", db.Tag("report"), `/* report */ SELECT * FROM "test_counters" WHERE id = $1 AND name = $2`},
+		{"ForUpdate", db.ForUpdate(), `SELECT * FROM "test_counters" WHERE id = $1 AND name = $2 FOR UPDATE`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var wg sync.WaitGroup
+			errs := make(chan string, 100)
+			for i := 0; i < 100; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					var rows []testCounter
+					name := fmt.Sprintf("n%d", i)
+					stmt := tt.session.Where("id = ?", i).Where("name = ?", name).Find(&rows).Statement
+
+					if sql := strings.TrimSpace(stmt.SQL.String()); sql != tt.want {
+						errs <- fmt.Sprintf("query %d: SQL %q; want %q", i, sql, tt.want)
+					}
+					if want := []interface{}{i, name}; !reflect.DeepEqual(stmt.Vars, want) {
+						errs <- fmt.Sprintf("query %d: vars %v; want %v", i, stmt.Vars, want)
+					}
+				}(i)
+			}
+			wg.Wait()
+			close(errs)
+
+			for err := range errs {
+				t.Error(err)
+			}
+		})
+	}
+}
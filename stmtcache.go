@@ -0,0 +1,206 @@
+/*
+Package database provides hit and miss metrics for the prepared statement cache.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+With Config.PrepareStmt, gorm keeps one prepared statement per distinct SQL string. When
+Config.Metrics also implements PreparedStatementMetrics, every statement run through the
+cache reports whether its SQL was already prepared. A low hit rate means many distinct
+dynamic queries, e.g. IN lists of varying length, each holding prepared statement memory on
+the server until ClearPreparedStatements or Config.PreparedStmtTTL evicts it.
+
+Example usage:
+
+	func (m *promMetrics) ObservePreparedStatement(hit bool) {
+	    m.stmtCache.WithLabelValues(strconv.FormatBool(hit)).Inc()
+	}
+
+	cfg.PrepareStmt = true
+	cfg.Metrics = &promMetrics{...}
+	db, _ := database.CreatePostgreSQL(cfg)
+
+Notes:
+  - Config.PrepareStmt cannot be combined with replicas, so every cached statement runs on
+    the primary.
+  - A failed statement is reported only when it missed the cache, as it may have failed
+    before the cache was looked up.
+*/
+
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"gorm.io/gorm"
+)
+
+// stmtCacheLookupKey is the statement instance key holding the cache lookup of a statement.
+const stmtCacheLookupKey = "database:stmt_cache_lookup"
+
+// stmtCacheMissKey is the context key of the flag set when a statement is prepared.
+type stmtCacheMissKey struct{}
+
+// stmtCacheLookup records the context of a statement before its miss flag was added.
+type stmtCacheLookup struct {
+	parent context.Context
+	missed *bool
+}
+
+// registerStmtCacheMetrics reports the prepared statement cache lookups of gormDB to m. It is a
+// no-op unless gormDB caches prepared statements.
+func registerStmtCacheMetrics(gormDB *gorm.DB, m PreparedStatementMetrics) error {
+	stmtDB, ok := gormDB.ConnPool.(*gorm.PreparedStmtDB)
+	if !ok {
+		return nil
+	}
+
+	// gorm prepares a statement on the pool only when its SQL is not cached yet, so calls
+	// to PrepareContext are exactly the misses.
+	pool := &stmtCachePool{ConnPool: stmtDB.ConnPool}
+	stmtDB.ConnPool = pool
+
+	observe := observeStmtCache(pool, m)
+	cb := gormDB.Callback()
+	if err := cb.Create().Before("gorm:create").Register("database:stmt_cache_lookup", trackStmtCache); err != nil {
+		return err
+	}
+	if err := cb.Create().After("gorm:create").Register("database:stmt_cache_metrics", observe); err != nil {
+		return err
+	}
+	if err := cb.Query().Before("gorm:query").Register("database:stmt_cache_lookup", trackStmtCache); err != nil {
+		return err
+	}
+	if err := cb.Query().After("gorm:query").Register("database:stmt_cache_metrics", observe); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("database:stmt_cache_lookup", trackStmtCache); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Register("database:stmt_cache_metrics", observe); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register("database:stmt_cache_lookup", trackStmtCache); err != nil {
+		return err
+	}
+	if err := cb.Delete().After("gorm:delete").Register("database:stmt_cache_metrics", observe); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:row").Register("database:stmt_cache_lookup", trackStmtCache); err != nil {
+		return err
+	}
+	if err := cb.Row().After("gorm:row").Register("database:stmt_cache_metrics", observe); err != nil {
+		return err
+	}
+	if err := cb.Raw().Before("gorm:raw").Register("database:stmt_cache_lookup", trackStmtCache); err != nil {
+		return err
+	}
+	return cb.Raw().After("gorm:raw").Register("database:stmt_cache_metrics", observe)
+}
+
+// trackStmtCache adds a miss flag to the statement's context.
+func trackStmtCache(tx *gorm.DB) {
+	if tx.Error != nil || tx.DryRun {
+		return
+	}
+
+	parent := tx.Statement.Context
+	if parent == nil {
+		parent = context.Background()
+	}
+
+	missed := new(bool)
+	tx.Statement.Context = context.WithValue(parent, stmtCacheMissKey{}, missed)
+	tx.InstanceSet(stmtCacheLookupKey, stmtCacheLookup{parent: parent, missed: missed})
+}
+
+// observeStmtCache returns a callback reporting the cache lookup of statements run through pool
+// to m and restoring their original context.
+func observeStmtCache(pool *stmtCachePool, m PreparedStatementMetrics) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		v, _ := tx.InstanceGet(stmtCacheLookupKey)
+		lookup, ok := v.(stmtCacheLookup)
+		if !ok {
+			return
+		}
+		tx.InstanceSet(stmtCacheLookupKey, nil)
+		tx.Statement.Context = lookup.parent
+
+		if !pool.serves(tx.Statement.ConnPool) || tx.Statement.SQL.Len() == 0 {
+			return
+		}
+		if tx.Error != nil && !*lookup.missed {
+			return
+		}
+		m.ObservePreparedStatement(!*lookup.missed)
+	}
+}
+
+// stmtCachePool wraps the connection pool of the prepared statement cache to record misses.
+type stmtCachePool struct {
+	gorm.ConnPool
+}
+
+// serves reports whether connPool, the connection pool of a statement, runs statements
+// through the prepared statement cache backed by p.
+func (p *stmtCachePool) serves(connPool gorm.ConnPool) bool {
+	switch c := connPool.(type) {
+	case *gorm.PreparedStmtDB:
+		return c.ConnPool == p
+	case *gorm.PreparedStmtTX:
+		return c.PreparedStmtDB != nil && c.PreparedStmtDB.ConnPool == p
+	}
+	return false
+}
+
+// PrepareContext prepares query and marks the statement running it as a miss.
+func (p *stmtCachePool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	markStmtCacheMiss(ctx)
+	return p.ConnPool.PrepareContext(ctx, query)
+}
+
+// BeginTx starts a transaction whose prepared statements are marked as misses as well.
+func (p *stmtCachePool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	beginner, ok := p.ConnPool.(gorm.TxBeginner)
+	if !ok {
+		return nil, gorm.ErrInvalidTransaction
+	}
+
+	tx, err := beginner.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &stmtCacheTx{Tx: tx}, nil
+}
+
+// GetDBConn returns the underlying *sql.DB, so gorm's DB method keeps working.
+func (p *stmtCachePool) GetDBConn() (*sql.DB, error) {
+	if sqlDB, ok := p.ConnPool.(*sql.DB); ok {
+		return sqlDB, nil
+	}
+	if connector, ok := p.ConnPool.(gorm.GetDBConnector); ok {
+		return connector.GetDBConn()
+	}
+	return nil, gorm.ErrInvalidDB
+}
+
+// stmtCacheTx wraps a transaction of the prepared statement cache to record misses.
+type stmtCacheTx struct {
+	*sql.Tx
+}
+
+// PrepareContext prepares query and marks the statement running it as a miss.
+func (tx *stmtCacheTx) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	markStmtCacheMiss(ctx)
+	return tx.Tx.PrepareContext(ctx, query)
+}
+
+// markStmtCacheMiss sets the miss flag of the statement running with ctx, if any.
+func markStmtCacheMiss(ctx context.Context) {
+	if missed, ok := ctx.Value(stmtCacheMissKey{}).(*bool); ok {
+		*missed = true
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Package database provides one-off comment tags for PostgreSQL statements.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+Tag returns a session whose statements start with a SQL comment, so a specific query can be
+found in pg_stat_activity, the server log or this package's logger during an investigation.
+
+WithHint returns a session whose statements start with a pg_hint_plan hint comment, a
+controlled escape hatch for the few queries the planner gets badly wrong, without moving the
+whole query to raw SQL. The pg_hint_plan extension must be loaded for hints to take effect;
+otherwise they are ignored like any comment. The hint always comes first, before a comment
+added with Tag, as pg_hint_plan only reads a hint at the start of the statement.
+
+Example usage:
+
+	// The query is sent as a comment holding "ticket-4211 slow export", followed by the SELECT.
+	db.Tag("ticket-4211 slow export").Where("tenant_id = ?", tenant).Find(&orders)
+
+	db.WithHint("IndexScan(users idx_users_email)").Where("email = ?", email).First(&user)
+*/
+
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// tagSetting is the statement setting holding the comment of a session returned by Tag.
+const tagSetting = "database:tag"
+
+// hintSetting is the statement setting holding the hint comment of a session returned by WithHint.
+const hintSetting = "database:hint"
+
+// ErrInvalidHint is returned by statements of a session created with an empty hint.
+var ErrInvalidHint = errors.New("invalid hint")
+
+// Tag returns a session whose statements are prefixed with comment as a SQL comment. Comment
+// delimiters in comment are removed, so it cannot end the comment early or open a nested one.
+//
+// Note that with Config.PrepareStmt every distinct comment prepares a statement of its own.
+//
+// Example:
+//
+//	db := database.New(...)
+//	err := db.Tag("debug order sync").Model(&order).Update("status", "synced").Error
+func (db *PostgreSQL) Tag(comment string) *gorm.DB {
+	return db.DB.Set(tagSetting, "/* "+sanitizeComment(comment)+" */").Session(&gorm.Session{})
+}
+
+// WithHint returns a session whose statements are prefixed with the pg_hint_plan hint comment
+// hint. hint may be given with or without its delimiters, e.g. "/*+ SeqScan(users) */" or
+// "SeqScan(users)". Comment delimiters inside the hint are removed, so it cannot end the
+// comment early and inject SQL. An empty hint fails every statement of the session with
+// ErrInvalidHint.
+//
+// Note that with Config.PrepareStmt every distinct hint prepares a statement of its own.
+//
+// Example:
+//
+//	db := database.New(...)
+//	err := db.WithHint("/*+ IndexScan(users idx_users_email) */").First(&user, "email = ?", email).Error
+func (db *PostgreSQL) WithHint(hint string) *gorm.DB {
+	hint = strings.TrimSpace(hint)
+	if strings.HasPrefix(hint, "/*+") && strings.HasSuffix(hint, "*/") && len(hint) >= len("/*+*/") {
+		hint = hint[len("/*+") : len(hint)-len("*/")]
+	}
+	hint = strings.TrimSpace(sanitizeComment(hint))
+
+	conn := db.DB.Session(&gorm.Session{})
+	if hint == "" {
+		conn.AddError(fmt.Errorf("%w; hint is empty", ErrInvalidHint))
+		return conn
+	}
+	return conn.Set(hintSetting, "/*+ "+hint+" */").Session(&gorm.Session{})
+}
+
+// sanitizeComment removes the comment delimiters from s.
+func sanitizeComment(s string) string {
+	for strings.Contains(s, "/*") || strings.Contains(s, "*/") {
+		s = strings.ReplaceAll(s, "/*", "")
+		s = strings.ReplaceAll(s, "*/", "")
+	}
+	return s
+}
+
+// registerTags registers callbacks prefixing the statements of sessions returned by Tag and
+// WithHint with their comments.
+func registerTags(gormDB *gorm.DB) error {
+	cb := gormDB.Callback()
+	if err := cb.Create().Before("gorm:create").Register("database:tag", tagStatement("INSERT")); err != nil {
+		return err
+	}
+	if err := cb.Query().Before("gorm:query").Register("database:tag", tagStatement("SELECT")); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("database:tag", tagStatement("UPDATE")); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register("database:tag", tagStatement("DELETE")); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:row").Register("database:tag", tagStatement("SELECT")); err != nil {
+		return err
+	}
+	return cb.Raw().Before("gorm:raw").Register("database:tag", tagStatement(""))
+}
+
+// tagStatement returns a callback prefixing the statement with the session's hint and comment.
+// Raw SQL is prefixed directly; statements still to be built get the comments before their
+// leading clause, clauseName.
+func tagStatement(clauseName string) func(tx *gorm.DB) {
+	return func(tx *gorm.DB) {
+		// The hint goes first, where pg_hint_plan looks for it.
+		var comments []string
+		for _, setting := range []string{hintSetting, tagSetting} {
+			if value, ok := tx.Get(setting); ok {
+				if comment, ok := value.(string); ok {
+					comments = append(comments, comment)
+				}
+			}
+		}
+		if len(comments) == 0 {
+			return
+		}
+		comment := strings.Join(comments, " ")
+
+		if tx.Statement.SQL.Len() > 0 {
+			sql := tx.Statement.SQL.String()
+			tx.Statement.SQL.Reset()
+			tx.Statement.SQL.WriteString(comment + " " + sql)
+			return
+		}
+		if clauseName != "" {
+			c := tx.Statement.Clauses[clauseName]
+			c.BeforeExpression = clause.Expr{SQL: comment}
+			tx.Statement.Clauses[clauseName] = c
+		}
+	}
+}
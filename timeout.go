@@ -0,0 +1,136 @@
+/*
+Package database provides a default timeout for statements without a deadline.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+When Config.DefaultQueryTimeout is set, every statement whose context carries no deadline
+runs under a child context that expires after the timeout, so a forgotten context cannot let
+a query run forever. Statements whose context already has a deadline, including one shorter
+or longer than the default, are left unchanged.
+
+Example usage:
+
+	cfg.DefaultQueryTimeout = 30 * time.Second
+	db, _ := database.CreatePostgreSQL(cfg)
+
+	db.Find(&users)                       // cancelled after 30s
+	db.WithContext(shortCtx).Find(&users) // bounded by shortCtx only
+
+Notes:
+  - For Row and Rows, the timeout also bounds reading the rows.
+  - Each statement of a transaction gets its own timeout; the transaction as a whole is not bounded.
+*/
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// queryTimeoutKey is the statement instance key holding the timeout applied to a statement.
+const queryTimeoutKey = "database:query_timeout"
+
+// appliedTimeout records the context of a statement before its default timeout was applied.
+type appliedTimeout struct {
+	parent context.Context
+	cancel context.CancelFunc
+}
+
+// registerQueryTimeout registers callbacks applying timeout to statements without a deadline.
+func registerQueryTimeout(gormDB *gorm.DB, timeout time.Duration) error {
+	apply := applyQueryTimeout(timeout)
+	cb := gormDB.Callback()
+
+	// Create, update and delete open their default transaction in gorm:begin_transaction,
+	// which must run under the timeout as well.
+	if err := cb.Create().Before("gorm:begin_transaction").Register("database:query_timeout", apply); err != nil {
+		return err
+	}
+	if err := cb.Create().After("gorm:commit_or_rollback_transaction").Register("database:release_query_timeout", releaseQueryTimeout); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:begin_transaction").Register("database:query_timeout", apply); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:commit_or_rollback_transaction").Register("database:release_query_timeout", releaseQueryTimeout); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:begin_transaction").Register("database:query_timeout", apply); err != nil {
+		return err
+	}
+	if err := cb.Delete().After("gorm:commit_or_rollback_transaction").Register("database:release_query_timeout", releaseQueryTimeout); err != nil {
+		return err
+	}
+	if err := cb.Query().Before("gorm:query").Register("database:query_timeout", apply); err != nil {
+		return err
+	}
+	if err := cb.Query().After("gorm:query").Register("database:release_query_timeout", releaseQueryTimeout); err != nil {
+		return err
+	}
+	if err := cb.Raw().Before("gorm:raw").Register("database:query_timeout", apply); err != nil {
+		return err
+	}
+	if err := cb.Raw().After("gorm:raw").Register("database:release_query_timeout", releaseQueryTimeout); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:row").Register("database:query_timeout", apply); err != nil {
+		return err
+	}
+	// Rows returned by Row and Rows are still being read when the callback chain ends, so
+	// their context is left to expire rather than cancelled.
+	return cb.Row().After("gorm:row").Register("database:release_query_timeout", restoreQueryContext)
+}
+
+// applyQueryTimeout returns a callback running the statement under timeout when its context
+// has no deadline.
+func applyQueryTimeout(timeout time.Duration) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		if tx.Error != nil || tx.DryRun {
+			return
+		}
+
+		parent := tx.Statement.Context
+		if parent == nil {
+			parent = context.Background()
+		}
+		if _, ok := parent.Deadline(); ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(parent, timeout)
+		tx.Statement.Context = ctx
+		tx.InstanceSet(queryTimeoutKey, appliedTimeout{parent: parent, cancel: cancel})
+	}
+}
+
+// releaseQueryTimeout cancels the statement's timeout context and restores its original context.
+func releaseQueryTimeout(tx *gorm.DB) {
+	if applied, ok := takeAppliedTimeout(tx); ok {
+		applied.cancel()
+	}
+}
+
+// restoreQueryContext restores the statement's original context, leaving its timeout context
+// to expire on its own.
+func restoreQueryContext(tx *gorm.DB) {
+	takeAppliedTimeout(tx)
+}
+
+// takeAppliedTimeout restores the statement's original context and returns the applied timeout, if any.
+func takeAppliedTimeout(tx *gorm.DB) (appliedTimeout, bool) {
+	v, _ := tx.InstanceGet(queryTimeoutKey)
+	applied, ok := v.(appliedTimeout)
+	if !ok {
+		return appliedTimeout{}, false
+	}
+
+	tx.InstanceSet(queryTimeoutKey, nil)
+	tx.Statement.Context = applied.parent
+	return applied, true
+}
@@ -0,0 +1,256 @@
+/*
+Package database provides context-scoped transaction propagation for PostgreSQL connections.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+A transaction started with WithTransaction is stored in the context passed to the
+callback. Code further down the call chain obtains its connection through Conn, which
+returns the ambient transaction when one is present and the plain database otherwise.
+Nested WithTransaction calls join the outer transaction instead of starting a new one.
+
+A transaction may be given a name with TxName. The name is set as the session's
+application_name for the duration of the transaction, so slow or locking transactions can
+be attributed to a code path in pg_stat_activity. It is set with SET LOCAL semantics and
+reverts when the transaction ends, leaving pooled connections unchanged.
+
+TxMaxStatements guards against runaway transactions, e.g. a loop accidentally issuing one
+statement per row: a statement exceeding the limit fails with ErrTooManyStatements and the
+transaction is rolled back, even when fn ignores the error.
+
+With the WithTransactionSummary logger option, every transaction started by WithTransaction
+is summarized in one log line with its outcome, duration and statement count.
+
+With Config.SlowTransactionThreshold, transactions taking longer than the threshold overall
+are logged as warnings. A transaction of fast statements can still be slow, e.g. when its
+statements wait on locks or the code between them is slow, which per-query logging misses.
+
+Example usage:
+
+	err := db.WithTransaction(ctx, func(ctx context.Context) error {
+	    if err := db.Conn(ctx).Create(&order).Error; err != nil {
+	        return err
+	    }
+	    return inventory.Reserve(ctx, order.Items) // joins the same transaction via db.Conn(ctx)
+	}, database.TxName("checkout"))
+*/
+
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// txContextKey is the context key under which the ambient transaction is stored.
+type txContextKey struct{}
+
+// ErrTooManyStatements is returned when a transaction exceeds the limit set with TxMaxStatements.
+var ErrTooManyStatements = errors.New("too many statements in transaction")
+
+// statementLimitSetting is the statement setting holding the transaction's statement limit.
+const statementLimitSetting = "database:statement_limit"
+
+// TxOption configures a transaction started by WithTransaction.
+type TxOption func(*txOptions)
+
+// txOptions holds the settings of a transaction started by WithTransaction.
+type txOptions struct {
+	name          string
+	maxStatements int
+	retries       int
+}
+
+// TxName names the transaction. The name is set as application_name until the transaction
+// ends. It has no effect when the transaction joins an ambient one.
+func TxName(name string) TxOption {
+	return func(o *txOptions) {
+		o.name = name
+	}
+}
+
+// TxMaxStatements limits the transaction to max statements. The statement exceeding the limit
+// fails with ErrTooManyStatements and the transaction is rolled back. Default is no limit.
+// It has no effect when the transaction joins an ambient one.
+func TxMaxStatements(max int) TxOption {
+	return func(o *txOptions) {
+		o.maxStatements = max
+	}
+}
+
+// TxRetries retries the transaction up to retries times when it fails with a serialization
+// failure or deadlock, which PostgreSQL resolves by aborting one of the transactions involved.
+// fn runs again from the start on a new transaction, so it must not have side effects outside
+// of it. A retry budget set with WithRetryBudget bounds the retries across calls. Default is
+// no retries. It has no effect when the transaction joins an ambient one.
+func TxRetries(retries int) TxOption {
+	return func(o *txOptions) {
+		o.retries = retries
+	}
+}
+
+// statementLimit counts the statements of a transaction against its limit.
+type statementLimit struct {
+	max   int64
+	count int64
+}
+
+// exceeded reports whether more than max statements have been counted.
+func (l *statementLimit) exceeded() bool {
+	return atomic.LoadInt64(&l.count) > l.max
+}
+
+// WithTransaction runs fn inside a database transaction and stores the transaction in the
+// context passed to fn. If ctx already carries a transaction, fn joins it and no new
+// transaction is started.
+//
+// The transaction is committed when fn returns nil and rolled back when fn returns an
+// error or panics. With TxRetries, a transaction rolled back by a serialization failure or
+// deadlock is run again.
+//
+// Example:
+//
+//	err := db.WithTransaction(ctx, func(ctx context.Context) error {
+//	    return db.Conn(ctx).Create(&user).Error
+//	}, database.TxName("create-user"))
+func (db *PostgreSQL) WithTransaction(ctx context.Context, fn func(ctx context.Context) error, opts ...TxOption) error {
+	if _, ok := transactionFromContext(ctx); ok {
+		return fn(ctx)
+	}
+
+	var o txOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	begin := time.Now()
+	for retries := 0; ; retries++ {
+		began, err := db.runTransaction(ctx, fn, o)
+		if err != nil && retries < o.retries && isRetryable(err) && takeRetry(ctx) {
+			continue
+		}
+
+		// Transactions that could not be started are not measured.
+		if db.metrics != nil && began {
+			outcome := TxCommitted
+			if err != nil {
+				outcome = TxRolledBack
+			}
+			db.metrics.ObserveTransaction(outcome, retries, time.Since(begin))
+		}
+		return err
+	}
+}
+
+// runTransaction makes one attempt at running fn inside a transaction. It reports whether the
+// transaction was started.
+func (db *PostgreSQL) runTransaction(ctx context.Context, fn func(ctx context.Context) error, o txOptions) (bool, error) {
+	conn := db.DB.WithContext(ctx)
+
+	// With WithTransactionSummary, statements are counted through the session's logger.
+	l, summary := conn.Logger.(*dbLogger)
+	summary = summary && l.txSummary
+	var statements int64
+	if summary {
+		conn = conn.Session(&gorm.Session{Logger: statementCounter{Interface: l, statements: &statements}})
+	}
+
+	begin, began := time.Now(), false
+	err := conn.Transaction(func(tx *gorm.DB) error {
+		began = true
+		if o.name != "" {
+			// is_local = true reverts the setting when the transaction ends.
+			if err := tx.Exec("SELECT set_config('application_name', ?, true)", o.name).Error; err != nil {
+				return fmt.Errorf("failed to name transaction; %s", err.Error())
+			}
+		}
+
+		if o.maxStatements <= 0 {
+			return fn(context.WithValue(ctx, txContextKey{}, tx))
+		}
+
+		// The limit is set after naming, so only the statements of fn are counted.
+		limit := &statementLimit{max: int64(o.maxStatements)}
+		tx = tx.Set(statementLimitSetting, limit)
+		if err := fn(context.WithValue(ctx, txContextKey{}, tx)); err != nil {
+			return err
+		}
+		if limit.exceeded() {
+			return fmt.Errorf("%w; limit is %d", ErrTooManyStatements, limit.max)
+		}
+		return nil
+	})
+
+	// No summary is logged when the transaction could not be started.
+	if summary && began {
+		l.traceTransaction(o.name, begin, atomic.LoadInt64(&statements), err)
+	}
+	if elapsed := time.Since(begin); began && db.slowTx > 0 && elapsed > db.slowTx {
+		name := o.name
+		if name == "" {
+			name = "unnamed"
+		}
+		conn.Logger.Warn(ctx, "slow transaction %s took %.3fms, threshold is %s", name, float64(elapsed.Nanoseconds())/1e6, db.slowTx)
+	}
+	return began, err
+}
+
+// Conn returns the transaction stored in ctx by WithTransaction, or the plain database
+// when no transaction is present. The returned session is bound to ctx.
+func (db *PostgreSQL) Conn(ctx context.Context) *gorm.DB {
+	if tx, ok := transactionFromContext(ctx); ok {
+		return tx.WithContext(ctx)
+	}
+	return db.DB.WithContext(ctx)
+}
+
+// transactionFromContext returns the ambient transaction stored in ctx, if any.
+func transactionFromContext(ctx context.Context) (*gorm.DB, bool) {
+	tx, ok := ctx.Value(txContextKey{}).(*gorm.DB)
+	return tx, ok
+}
+
+// registerStatementLimit registers callbacks enforcing TxMaxStatements.
+func registerStatementLimit(gormDB *gorm.DB) error {
+	cb := gormDB.Callback()
+	if err := cb.Create().Before("gorm:begin_transaction").Register("database:statement_limit", countStatement); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:begin_transaction").Register("database:statement_limit", countStatement); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:begin_transaction").Register("database:statement_limit", countStatement); err != nil {
+		return err
+	}
+	if err := cb.Query().Before("gorm:query").Register("database:statement_limit", countStatement); err != nil {
+		return err
+	}
+	if err := cb.Raw().Before("gorm:raw").Register("database:statement_limit", countStatement); err != nil {
+		return err
+	}
+	return cb.Row().Before("gorm:row").Register("database:statement_limit", countStatement)
+}
+
+// countStatement counts the statement against the limit of its transaction, failing it once
+// the limit is exceeded.
+func countStatement(tx *gorm.DB) {
+	// Dry runs, including subqueries being built, are not sent to the server.
+	if tx.Error != nil || tx.DryRun {
+		return
+	}
+
+	value, ok := tx.Get(statementLimitSetting)
+	if !ok {
+		return
+	}
+	if limit, ok := value.(*statementLimit); ok && atomic.AddInt64(&limit.count, 1) > limit.max {
+		tx.AddError(fmt.Errorf("%w; limit is %d", ErrTooManyStatements, limit.max))
+	}
+}
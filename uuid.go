@@ -0,0 +1,144 @@
+/*
+Package database provides client-side generation of UUID primary keys.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+With Config.GenerateUUID set, creates assign a generated UUID to every record whose primary
+key is a UUID and still zero, so models need no BeforeCreate hook. A primary key is a UUID
+when its Go type is a 16-byte array, such as uuid.UUID of github.com/google/uuid, or a
+string field with the uuid column type. Records that already carry a key keep it.
+
+NewUUIDv7 generates time-ordered keys, which keep B-tree index inserts local; NewUUIDv4
+generates random ones. Any function of the same type can be set instead, e.g. a
+deterministic sequence in tests.
+
+Example usage:
+
+	type Order struct {
+	    ID    uuid.UUID `gorm:"type:uuid;primaryKey"`
+	    Total int64
+	}
+
+	cfg.GenerateUUID = database.NewUUIDv7
+	db, _ := database.CreatePostgreSQL(cfg)
+	db.Create(&order) // order.ID is set before the INSERT
+*/
+
+package database
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// UUIDFunc generates a UUID.
+type UUIDFunc func() [16]byte
+
+// NewUUIDv4 returns a random UUID, version 4 of RFC 9562.
+func NewUUIDv4() [16]byte {
+	var u [16]byte
+	_, _ = rand.Read(u[:]) // crypto/rand never fails on supported platforms
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return u
+}
+
+// NewUUIDv7 returns a time-ordered UUID, version 7 of RFC 9562: a millisecond Unix timestamp
+// followed by random bits.
+func NewUUIDv7() [16]byte {
+	u := NewUUIDv4()
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(time.Now().UnixMilli()))
+	copy(u[:6], ms[2:])
+	u[6] = u[6]&0x0f | 0x70
+	return u
+}
+
+// formatUUID returns the canonical text form of u, e.g. "0190a0c4-1b2c-7d3e-8f40-5a6b7c8d9e0f".
+func formatUUID(u [16]byte) string {
+	var b [36]byte
+	hex.Encode(b[0:8], u[0:4])
+	b[8] = '-'
+	hex.Encode(b[9:13], u[4:6])
+	b[13] = '-'
+	hex.Encode(b[14:18], u[6:8])
+	b[18] = '-'
+	hex.Encode(b[19:23], u[8:10])
+	b[23] = '-'
+	hex.Encode(b[24:], u[10:])
+	return string(b[:])
+}
+
+// registerUUIDKeys registers a callback assigning UUID primary keys generated by generate on create.
+func registerUUIDKeys(gormDB *gorm.DB, generate UUIDFunc) error {
+	return gormDB.Callback().Create().Before("gorm:create").Register("database:uuid_keys", setUUIDKeys(generate))
+}
+
+// setUUIDKeys returns a callback assigning a generated UUID to every record with a zero UUID primary key.
+func setUUIDKeys(generate UUIDFunc) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		if tx.Error != nil || tx.Statement.Schema == nil {
+			return
+		}
+
+		field := tx.Statement.Schema.PrioritizedPrimaryField
+		if field == nil {
+			return
+		}
+		kind, ok := uuidKind(field)
+		if !ok {
+			return
+		}
+
+		ctx := tx.Statement.Context
+		assign := func(record reflect.Value) {
+			if _, zero := field.ValueOf(ctx, record); !zero {
+				return
+			}
+
+			var value interface{} = generate()
+			if kind == reflect.String {
+				value = formatUUID(value.([16]byte))
+			}
+			if err := field.Set(ctx, record, value); err != nil {
+				tx.AddError(err)
+			}
+		}
+
+		switch rv := tx.Statement.ReflectValue; rv.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < rv.Len(); i++ {
+				assign(reflect.Indirect(rv.Index(i)))
+			}
+		case reflect.Struct:
+			assign(rv)
+		}
+	}
+}
+
+// uuidKind reports whether field holds a UUID, a 16-byte array or a string with the uuid
+// column type, and returns the kind of its value.
+func uuidKind(field *schema.Field) (reflect.Kind, bool) {
+	t := field.FieldType
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Array:
+		return t.Kind(), t.Len() == 16 && t.Elem().Kind() == reflect.Uint8
+	case reflect.String:
+		return t.Kind(), strings.EqualFold(string(field.DataType), "uuid")
+	}
+	return t.Kind(), false
+}
@@ -0,0 +1,140 @@
+/*
+Package database provides connection validation for PostgreSQL configurations.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+ValidateConnection performs a "dry connect": it opens a single connection, pings the
+server and closes the connection again without creating a pool. Failures are categorized
+so callers such as configuration validation tools can report what went wrong.
+
+Example usage:
+
+	err := database.ValidateConnection(ctx, cfg)
+	switch {
+	case errors.Is(err, database.ErrAuthentication):
+	    fmt.Println("check the user name and password:", err)
+	case errors.Is(err, database.ErrUnreachable):
+	    fmt.Println("check the host and port:", err)
+	case errors.Is(err, database.ErrUnknownDatabase):
+	    fmt.Println("check the database name:", err)
+	case errors.Is(err, database.ErrUnknownTimezone):
+	    fmt.Println("check the time zone:", err)
+	case err != nil:
+	    fmt.Println("connection failed:", err)
+	}
+*/
+
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Errors returned by ValidateConnection to categorize connection failures.
+var (
+	ErrAuthentication  = errors.New("authentication failed")
+	ErrUnreachable     = errors.New("database server unreachable")
+	ErrUnknownDatabase = errors.New("database does not exist")
+	ErrUnknownTimezone = errors.New("time zone not recognized by the server")
+)
+
+// SQLSTATEs reported by the server while establishing a connection.
+const (
+	sqlStateInvalidAuthorization = "28000"
+	sqlStateInvalidPassword      = "28P01"
+	sqlStateInvalidCatalogName   = "3D000"
+	sqlStateInvalidParameter     = "22023"
+)
+
+// ValidateConnection verifies that cfg can be used to connect to the database. It opens a
+// single connection, pings the server and closes the connection immediately.
+//
+// Parameters:
+//
+//	ctx (context.Context): Context bounding the connection attempt.
+//	cfg (*Config): Configuration to validate. It is not modified.
+//
+// Returns:
+//
+//	error: nil when the connection succeeds, otherwise an error wrapping ErrAuthentication,
+//	ErrUnreachable, ErrUnknownDatabase or ErrUnknownTimezone when the cause is known.
+//
+// Example:
+//
+//	if err := database.ValidateConnection(ctx, cfg); err != nil {
+//	    fmt.Println("Invalid database configuration:", err)
+//	}
+func ValidateConnection(ctx context.Context, cfg *Config) error {
+	connConfig, err := validationConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	conn, err := pgconn.ConnectConfig(ctx, connConfig)
+	if err != nil {
+		return categorizeConnectError(err)
+	}
+	defer conn.Close(context.Background())
+
+	if err := conn.Ping(ctx); err != nil {
+		return categorizeConnectError(err)
+	}
+
+	return nil
+}
+
+// validationConfig returns the connection settings ValidateConnection connects with. As in
+// openPool, the libpq-only options are removed rather than sent to the server.
+func validationConfig(cfg *Config) (*pgconn.Config, error) {
+	c := *cfg
+	if c.Timezone == "" {
+		c.Timezone = "Asia/Jakarta"
+	}
+	if _, err := c.password(); err != nil {
+		return nil, fmt.Errorf("failed to read password file; %s", err.Error())
+	}
+
+	connConfig, err := pgconn.ParseConfig(c.DSN())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse dsn; %s", err.Error())
+	}
+	if err := removeLibpqOnlyParams(connConfig.RuntimeParams); err != nil {
+		return nil, fmt.Errorf("failed to connect database; %s", err.Error())
+	}
+	return connConfig, nil
+}
+
+// categorizeConnectError wraps err with the sentinel error matching its cause.
+func categorizeConnectError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case sqlStateInvalidAuthorization, sqlStateInvalidPassword:
+			return fmt.Errorf("%w; %s", ErrAuthentication, err.Error())
+		case sqlStateInvalidCatalogName:
+			return fmt.Errorf("%w; %s", ErrUnknownDatabase, err.Error())
+		case sqlStateInvalidParameter:
+			// The time zone is resolved by the server from its own tz database, so a missing
+			// tzdata package on the client is never the cause.
+			if strings.Contains(pgErr.Message, `"TimeZone"`) {
+				return fmt.Errorf("%w; check Config.Timezone against pg_timezone_names; %s", ErrUnknownTimezone, err.Error())
+			}
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return fmt.Errorf("%w; %s", ErrUnreachable, err.Error())
+	}
+
+	return fmt.Errorf("failed to connect database; %s", err.Error())
+}
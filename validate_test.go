@@ -0,0 +1,36 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestValidationConfigRemovesLibpqOnlyParams(t *testing.T) {
+	cfg := &Config{Host: "localhost", Port: 5432, User: "app", Name: "app", GSSEncMode: "prefer", ChannelBinding: "disable"}
+
+	connConfig, err := validationConfig(cfg)
+	if err != nil {
+		t.Fatalf("validationConfig failed; %s", err.Error())
+	}
+	for _, key := range libpqOnlyParams {
+		if value, ok := connConfig.RuntimeParams[key]; ok {
+			t.Errorf("run-time parameter %s=%s is sent to the server", key, value)
+		}
+	}
+}
+
+func TestValidateConnectionRejectsRequire(t *testing.T) {
+	tests := map[string]Config{
+		"gssencmode":      {Host: "localhost", Port: 5432, User: "app", Name: "app", GSSEncMode: "require"},
+		"channel_binding": {Host: "localhost", Port: 5432, User: "app", Name: "app", ChannelBinding: "require"},
+	}
+	for key, cfg := range tests {
+		t.Run(key, func(t *testing.T) {
+			err := ValidateConnection(context.Background(), &cfg)
+			if err == nil || !strings.Contains(err.Error(), key+"=require") {
+				t.Errorf("ValidateConnection() = %v; want %s=require rejected", err, key)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Package database provides optimistic locking with a version column.
+
+Version: 0.0.1
+License: Apache License 2.0
+
+Author: dexterdmonkey
+
+Optimistic locking lets concurrent writers read a row without locking it and detects, at
+write time, whether someone else changed it in the meantime. Each row carries a version
+number: UpdateWithVersion writes a model only if its row is still at the version the caller
+read, and increments the version in the same statement. When another writer got there
+first, no row matches and ErrVersionConflict is returned, so the caller can reload and retry
+or report the conflict.
+
+Example usage:
+
+	type Document struct {
+	    ID      uint
+	    Body    string
+	    Version int
+	}
+
+	var doc Document
+	db.First(&doc, id)
+	read := doc.Version
+
+	doc.Body = edit(doc.Body)
+	// UPDATE "documents" SET "body"=$1,"version"=$2 WHERE "documents"."version" = $3 AND "id" = $4
+	err := db.UpdateWithVersion(ctx, &doc, read)
+	if errors.Is(err, database.ErrVersionConflict) {
+	    // reload and retry, or answer 409 Conflict
+	}
+*/
+
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrVersionConflict is returned by UpdateWithVersion when the row is no longer at the expected version.
+var ErrVersionConflict = errors.New("version conflict")
+
+// versionColumn is the column holding the version of a row for UpdateWithVersion.
+const versionColumn = "version"
+
+// UpdateWithVersion writes every field of model to its row, as Save does, provided the row's
+// version column is still expectedVersion, and sets the version to expectedVersion + 1. On
+// success the model's version field holds the new version; otherwise it is left unchanged.
+//
+// Parameters:
+//
+//	ctx (context.Context): Context of the update. An ambient transaction from WithTransaction is joined.
+//	model (interface{}): Pointer to the model to write. It needs a non-zero primary key and an
+//	  integer field stored in the "version" column.
+//	expectedVersion (int): Version the row had when model was read.
+//
+// Returns:
+//
+//	error: ErrVersionConflict if the row is missing or at another version, or an error if the
+//	  model is invalid or the update fails.
+//
+// Example:
+//
+//	db := database.New(...)
+//	err := db.UpdateWithVersion(ctx, &order, order.Version)
+//	if errors.Is(err, database.ErrVersionConflict) {
+//	    fmt.Println("Order was changed concurrently")
+//	}
+func (db *PostgreSQL) UpdateWithVersion(ctx context.Context, model interface{}, expectedVersion int) error {
+	stmt := &gorm.Statement{DB: db.DB}
+	if err := stmt.Parse(model); err != nil {
+		return fmt.Errorf("failed to update with version; %s", err.Error())
+	}
+
+	value := reflect.ValueOf(model)
+	if value.Kind() != reflect.Ptr || value.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("failed to update with version; model must be a pointer to a struct, got %T", model)
+	}
+	value = value.Elem()
+
+	version := stmt.Schema.LookUpField(versionColumn)
+	if version == nil {
+		return fmt.Errorf("failed to update with version; %s has no %s column", stmt.Schema.Name, versionColumn)
+	}
+	pk := stmt.Schema.PrioritizedPrimaryField
+	if pk == nil {
+		return fmt.Errorf("failed to update with version; %s has no primary key", stmt.Schema.Name)
+	}
+	id, zero := pk.ValueOf(ctx, value)
+	if zero {
+		// Without a primary key, every row at the expected version would be updated.
+		return fmt.Errorf("failed to update with version; %s has no primary key value", stmt.Schema.Name)
+	}
+
+	previous, _ := version.ValueOf(ctx, value)
+	if err := version.Set(ctx, value, expectedVersion+1); err != nil {
+		return fmt.Errorf("failed to update with version; %s", err.Error())
+	}
+
+	result := db.Conn(ctx).
+		Model(model).
+		Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: version.DBName}, Value: expectedVersion}).
+		Select("*").
+		Updates(model)
+	if result.Error != nil || result.RowsAffected == 0 {
+		if err := version.Set(ctx, value, previous); err != nil {
+			return fmt.Errorf("failed to update with version; %s", err.Error())
+		}
+	}
+	if result.Error != nil {
+		return fmt.Errorf("failed to update with version; %s", result.Error.Error())
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w; %s %v is not at version %d", ErrVersionConflict, stmt.Schema.Table, id, expectedVersion)
+	}
+
+	return nil
+}